@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minutes to wait for the required assets of a release when not specified
+const defaultAssetTimeout = 60
+
+// a release whose actions are held back until its required assets are uploaded
+type pendingRelease struct {
+	release *Release
+	since   time.Time
+}
+
+// returns the required asset patterns of the repo no asset of the release matches
+func missingAssets(repo RepositoryEntry, release *Release) []string {
+	var missing []string
+	for _, pattern := range repo.Assets {
+		found := false
+		for _, asset := range release.Assets {
+			if matched, _ := path.Match(pattern, asset.GetName()); matched {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, pattern)
+		}
+	}
+	return missing
+}
+
+func assetTimeout(repo RepositoryEntry) time.Duration {
+	timeout := repo.AssetTimeout
+	if timeout <= 0 {
+		timeout = defaultAssetTimeout
+	}
+	return time.Duration(timeout) * time.Minute
+}
+
+// holds the release back until its assets are complete
+func (h *releaseHistory) addPending(release *Release) {
+	h.Lock()
+	defer h.Unlock()
+	h.pending[release.GetTagName()] = &pendingRelease{release: release, since: time.Now()}
+}
+
+// re-checks the assets of the pending releases against their latest listing, returning the releases whose assets
+// are now complete and those that gave up waiting (marked with the timed out event)
+//
+// pending releases missing from the listing (deleted, or beyond the pages fetched) keep their last known assets,
+// so they still time out
+func (h *releaseHistory) checkPendingReleases(repo RepositoryEntry, latestReleases []*Release) (ready []*Release, timedOut []*Release) {
+	h.Lock()
+	defer h.Unlock()
+	for _, latest := range latestReleases {
+		if pending, ok := h.pending[latest.GetTagName()]; ok {
+			pending.release.Assets = latest.Assets
+		}
+	}
+	// in the order the releases were found
+	var tags []string
+	for tag := range h.pending {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return h.pending[tags[i]].since.Before(h.pending[tags[j]].since)
+	})
+	for _, tag := range tags {
+		pending := h.pending[tag]
+		missing := missingAssets(repo, pending.release)
+		switch {
+		case len(missing) == 0:
+			ready = append(ready, pending.release)
+		case time.Since(pending.since) > assetTimeout(repo):
+			pending.release.Event = EventAssetsTimedOut
+			if pending.release.Variables == nil {
+				pending.release.Variables = make(map[string]string)
+			}
+			pending.release.Variables["RELEASE.MISSINGASSETS"] = strings.Join(missing, ",")
+			timedOut = append(timedOut, pending.release)
+		default:
+			continue
+		}
+		delete(h.pending, tag)
+	}
+	return ready, timedOut
+}
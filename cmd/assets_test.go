@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func testReleaseWithAssets(tag string, assets ...string) *Release {
+	release := &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String(tag)}}
+	for _, asset := range assets {
+		release.Assets = append(release.Assets, &github.ReleaseAsset{Name: github.String(asset)})
+	}
+	return release
+}
+
+func TestMissingAssets(t *testing.T) {
+	repo := RepositoryEntry{Assets: []string{"rke2.linux-amd64.tar.gz", "rke2-images.*.tar.zst", "sha256sum-*.txt"}}
+	release := testReleaseWithAssets("v1.28.2+rke2r1", "rke2.linux-amd64.tar.gz", "rke2-images.linux-amd64.tar.zst")
+	if missing := missingAssets(repo, release); !reflect.DeepEqual(missing, []string{"sha256sum-*.txt"}) {
+		t.Errorf("Expected only the checksums to be missing, got %v", missing)
+	}
+	if missing := missingAssets(RepositoryEntry{}, release); len(missing) != 0 {
+		t.Errorf("Expected no assets to be required by default, got %v", missing)
+	}
+}
+
+func TestCheckPendingReleases(t *testing.T) {
+	repo := RepositoryEntry{Owner: "assets", Repo: "pending", Assets: []string{"*.tar.gz"}, AssetTimeout: 30}
+	history := getReleaseHistory(repo)
+	history.addPending(testReleaseWithAssets("v1.0.0"))
+	history.addPending(testReleaseWithAssets("v1.1.0"))
+
+	ready, timedOut := history.checkPendingReleases(repo, []*Release{testReleaseWithAssets("v1.0.0"), testReleaseWithAssets("v1.1.0")})
+	if len(ready) != 0 || len(timedOut) != 0 {
+		t.Fatalf("Expected releases without assets to stay pending")
+	}
+
+	history.pending["v1.1.0"].since = time.Now().Add(-time.Hour)
+	ready, timedOut = history.checkPendingReleases(repo, []*Release{
+		testReleaseWithAssets("v1.0.0", "release.tar.gz"),
+		testReleaseWithAssets("v1.1.0"),
+	})
+	if len(ready) != 1 || ready[0].GetTagName() != "v1.0.0" || ready[0].event() != EventPublished {
+		t.Errorf("Expected v1.0.0 to be ready once its assets were uploaded, got %v", ready)
+	}
+	if len(timedOut) != 1 || timedOut[0].event() != EventAssetsTimedOut || timedOut[0].Variables["RELEASE.MISSINGASSETS"] != "*.tar.gz" {
+		t.Errorf("Expected v1.1.0 to time out, got %v", timedOut)
+	}
+	if len(history.pending) != 0 {
+		t.Errorf("Expected ready and timed out releases to no longer be pending")
+	}
+
+	// a pending release that was deleted (or isn't on the pages fetched) still times out
+	history.addPending(testReleaseWithAssets("v1.2.0"))
+	history.pending["v1.2.0"].since = time.Now().Add(-time.Hour)
+	_, timedOut = history.checkPendingReleases(repo, nil)
+	if len(timedOut) != 1 || timedOut[0].GetTagName() != "v1.2.0" || len(history.pending) != 0 {
+		t.Errorf("Expected v1.2.0 to time out without being listed, got %v", timedOut)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// separates the channel name from the version in the tag names of channel releases
+const channelTagSeparator = "@"
+
+type channelCollection struct {
+	Data []struct {
+		Name   string `json:"name"`
+		Latest string `json:"latest"`
+	} `json:"data"`
+}
+
+// the last known version of every channel, keyed by release history file path and channel name
+var channelVersions = struct {
+	sync.Mutex
+	versions map[string]map[string]string
+}{versions: make(map[string]map[string]string)}
+
+// when each channel release was first listed, keyed by release history file path and tag, as channel servers carry no dates
+var channelListings = struct {
+	sync.Mutex
+	listed map[string]time.Time
+}{listed: make(map[string]time.Time)}
+
+// fetches the channels of a k3s/rke2 style channel server as releases
+//
+// each release stands for a channel pointing at a version so a release is new whenever a channel's latest moves,
+// the tag name is channel@version while $RELEASE.TAGNAME is the plain version, the release history only keeps
+// the version each channel points at, so a channel moving back to a version it pointed at before is new again
+func getAllChannelReleases(repo RepositoryEntry) ([]*Release, error) {
+	req, err := http.NewRequest("GET", repo.webURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("channel server returned %s for %s", resp.Status, repo.webURL())
+	}
+	var channels channelCollection
+	if err := json.NewDecoder(resp.Body).Decode(&channels); err != nil {
+		return nil, err
+	}
+
+	watched := make(map[string]bool)
+	for _, channel := range repo.Channels {
+		watched[channel] = true
+	}
+	var releases []*Release
+	for _, channel := range channels.Data {
+		if channel.Latest == "" || (len(watched) > 0 && !watched[channel.Name]) {
+			continue
+		}
+		seedChannelVersion(repo, channel.Name, channel.Latest)
+		release := &Release{
+			RepositoryRelease: &github.RepositoryRelease{
+				TagName:     github.String(channel.Name + channelTagSeparator + channel.Latest),
+				Name:        github.String(fmt.Sprintf("%s (%s channel)", channel.Latest, channel.Name)),
+				Draft:       github.Bool(false),
+				Prerelease:  github.Bool(isPrereleaseTag(channel.Latest)),
+				PublishedAt: &github.Timestamp{Time: channelListedAt(repo, channel.Name+channelTagSeparator+channel.Latest)},
+			},
+			Variables: map[string]string{
+				"RELEASE.TAGNAME": channel.Latest,
+				"CHANNEL.NAME":    channel.Name,
+				"CHANNEL.VERSION": channel.Latest,
+			},
+		}
+		if repo.Owner != "" && repo.Repo != "" {
+			release.HTMLURL = github.String(fmt.Sprintf("https://github.com/%s/%s/releases/tag/%s", repo.Owner, repo.Repo, channel.Latest))
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// records the version of a channel unless one is already known
+//
+// with persistence enabled the last version recorded in the release history file is preferred so
+// moves that happened while releasebot was down still report the right previous version
+func seedChannelVersion(repo RepositoryEntry, channel string, version string) {
+	key := releaseHistoryFilePath(repo)
+	channelVersions.Lock()
+	defer channelVersions.Unlock()
+	if channelVersions.versions[key] == nil {
+		channelVersions.versions[key] = make(map[string]string)
+	}
+	if _, ok := channelVersions.versions[key][channel]; ok {
+		return
+	}
+	if persist {
+		if recorded := lastRecordedChannelVersion(key, channel); recorded != "" {
+			version = recorded
+		}
+	}
+	channelVersions.versions[key][channel] = version
+}
+
+// returns the version of the channel that was appended last to the release history file
+func lastRecordedChannelVersion(releaseHistoryFile string, channel string) string {
+	return recordedChannelVersions(releaseHistoryFile)[channel]
+}
+
+// returns the version of every channel that was appended last to the release history file
+func recordedChannelVersions(releaseHistoryFile string) map[string]string {
+	versions := make(map[string]string)
+	file, err := os.Open(releaseHistoryFile)
+	if err != nil {
+		return versions
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if channel, version, ok := strings.Cut(scanner.Text(), channelTagSeparator); ok {
+			versions[channel] = version
+		}
+	}
+	return versions
+}
+
+// returns the version every channel of the listing points at
+func currentChannelVersions(releases []*Release) map[string]string {
+	versions := make(map[string]string)
+	for _, release := range releases {
+		if channel, version, ok := strings.Cut(release.GetTagName(), channelTagSeparator); ok {
+			versions[channel] = version
+		}
+	}
+	return versions
+}
+
+// returns when the channel release was first listed (since it was last forgotten)
+func channelListedAt(repo RepositoryEntry, tag string) time.Time {
+	key := releaseHistoryFilePath(repo) + " " + tag
+	channelListings.Lock()
+	defer channelListings.Unlock()
+	if listed, ok := channelListings.listed[key]; ok {
+		return listed
+	}
+	listed := time.Now()
+	channelListings.listed[key] = listed
+	return listed
+}
+
+// forgets the releases of channels that no longer point at them, so a channel moving back to a version it
+// pointed at before is found as a new release again
+//
+// current holds the version each channel points at, channels missing from it (e.g. those of the other release type) are kept
+func (h *releaseHistory) forgetSupersededChannelReleases(current map[string]string) {
+	h.Lock()
+	defer h.Unlock()
+	channelListings.Lock()
+	defer channelListings.Unlock()
+	for tag := range h.releases {
+		channel, version, ok := strings.Cut(tag, channelTagSeparator)
+		if latest, listed := current[channel]; !ok || !listed || version == latest {
+			continue
+		}
+		delete(h.releases, tag)
+		delete(h.fingerprints, tag)
+		delete(h.missing, tag)
+		delete(h.retags, tag)
+		delete(channelListings.listed, releaseHistoryFilePath(h.repo)+" "+tag)
+	}
+}
+
+// returns the version a known tag stands for, the plain version of a channel@version tag
+func knownTagVersion(repo RepositoryEntry, tag string) string {
+	if repo.source() == SourceChannels {
+		if _, version, ok := strings.Cut(tag, channelTagSeparator); ok {
+			return version
+		}
+	}
+	return tag
+}
+
+// sets the previous version of the channel a newly found release moved
+func resolveChannelReleaseDetails(repo RepositoryEntry, release *Release) error {
+	channel, version, ok := strings.Cut(release.GetTagName(), channelTagSeparator)
+	if !ok {
+		return fmt.Errorf("invalid channel release %s", release.GetTagName())
+	}
+	key := releaseHistoryFilePath(repo)
+	channelVersions.Lock()
+	defer channelVersions.Unlock()
+	if channelVersions.versions[key] == nil {
+		channelVersions.versions[key] = make(map[string]string)
+	}
+	previous := channelVersions.versions[key][channel]
+	if previous == version {
+		// the channel was first seen with this version, nothing is known about what came before
+		previous = ""
+	}
+	release.Variables["CHANNEL.PREVIOUS"] = previous
+	if previous != "" {
+		release.Name = github.String(fmt.Sprintf("%s (%s channel, previously %s)", version, channel, previous))
+	}
+	channelVersions.versions[key][channel] = version
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChannelReleases(t *testing.T) {
+	stable := "v1.27.5+k3s1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{
+			"type": "collection",
+			"resourceType": "channels",
+			"data": [
+				{"id": "stable", "type": "channel", "name": "stable", "latest": "%s"},
+				{"id": "latest", "type": "channel", "name": "latest", "latest": "v1.28.2+k3s1"},
+				{"id": "testing", "type": "channel", "name": "testing", "latest": "v1.28.3-rc1+k3s1"},
+				{"id": "v1.26", "type": "channel", "name": "v1.26", "latest": "v1.26.9+k3s1"}
+			]
+		}`, stable)
+	}))
+	defer server.Close()
+
+	repo := RepositoryEntry{
+		Source:   SourceChannels,
+		Url:      server.URL,
+		Owner:    "k3s-io",
+		Repo:     "k3s",
+		Channels: []string{"stable", "latest", "testing"},
+	}
+
+	baseline, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get channel releases: %v", err)
+	}
+	if len(baseline) != 2 {
+		t.Fatalf("Expected the stable and latest channels as releases, got %d", len(baseline))
+	}
+	loadedReleasesMap := make(map[string]bool)
+	checkForNewReleases(baseline, loadedReleasesMap)
+
+	stable = "v1.28.2+k3s1"
+	latestReleases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get channel releases: %v", err)
+	}
+	newReleases := checkForNewReleases(latestReleases, loadedReleasesMap)
+	if len(newReleases) != 1 {
+		t.Fatalf("Expected only the stable channel move to be new, got %d releases", len(newReleases))
+	}
+	release := newReleases[0]
+	if err := resolveReleaseDetails(repo, release); err != nil {
+		t.Fatalf("Failed to resolve release details: %v", err)
+	}
+	expectedVariables := map[string]string{
+		"RELEASE.TAGNAME":  "v1.28.2+k3s1",
+		"CHANNEL.NAME":     "stable",
+		"CHANNEL.VERSION":  "v1.28.2+k3s1",
+		"CHANNEL.PREVIOUS": "v1.27.5+k3s1",
+	}
+	for name, expected := range expectedVariables {
+		if release.Variables[name] != expected {
+			t.Errorf("Expected $%s to be %s, got %s", name, expected, release.Variables[name])
+		}
+	}
+	if release.GetHTMLURL() != "https://github.com/k3s-io/k3s/releases/tag/v1.28.2+k3s1" {
+		t.Errorf("Unexpected html url %s", release.GetHTMLURL())
+	}
+}
+
+func TestLastRecordedChannelVersion(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history")
+	history := "stable@v1.26.9+k3s1\nlatest@v1.27.5+k3s1\nstable@v1.27.5+k3s1\nlatest@v1.28.2+k3s1\n"
+	if err := os.WriteFile(historyFile, []byte(history), 0644); err != nil {
+		t.Fatalf("Failed to write history file: %v", err)
+	}
+	if version := lastRecordedChannelVersion(historyFile, "stable"); version != "v1.27.5+k3s1" {
+		t.Errorf("Expected last stable version to be v1.27.5+k3s1, got %s", version)
+	}
+	if version := lastRecordedChannelVersion(historyFile, "testing"); version != "" {
+		t.Errorf("Expected no testing version, got %s", version)
+	}
+}
+
+func TestChannelRollback(t *testing.T) {
+	stable := "v1.27.5+k3s1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": [{"name": "stable", "latest": "%s"}, {"name": "testing", "latest": "v1.28.3-rc1+k3s1"}]}`, stable)
+	}))
+	defer server.Close()
+
+	repo := RepositoryEntry{Source: SourceChannels, Url: server.URL, Owner: "k3s-io", Repo: "rollback"}
+	history := getReleaseHistory(repo)
+	poll := func() []*Release {
+		latestReleases, err := getLatestReleases(repo, false, -1)
+		if err != nil {
+			t.Fatalf("Failed to get channel releases: %v", err)
+		}
+		newReleases := history.checkForNewReleases(latestReleases)
+		history.forgetSupersededChannelReleases(currentChannelVersions(latestReleases))
+		for _, release := range newReleases {
+			if err := resolveReleaseDetails(repo, release); err != nil {
+				t.Fatalf("Failed to resolve release details: %v", err)
+			}
+		}
+		return newReleases
+	}
+	history.merge(map[string]bool{"testing@v1.28.3-rc1+k3s1": true})
+	first := poll()
+	if len(first) != 1 {
+		t.Fatalf("Expected the stable channel to be new, got %d releases", len(first))
+	}
+	if again := poll(); len(again) != 0 {
+		t.Fatalf("Expected an unmoved channel not to be new, got %v", again)
+	}
+	latestReleases, _ := getLatestReleases(repo, false, -1)
+	if !latestReleases[0].GetPublishedAt().Equal(first[0].GetPublishedAt()) {
+		t.Errorf("Expected the publish date of a channel release to be stable across polls")
+	}
+
+	stable = "v1.28.2+k3s1"
+	if moved := poll(); len(moved) != 1 || moved[0].Variables["CHANNEL.PREVIOUS"] != "v1.27.5+k3s1" {
+		t.Fatalf("Expected the stable channel move to be new, got %v", moved)
+	}
+	stable = "v1.27.5+k3s1"
+	rolledBack := poll()
+	if len(rolledBack) != 1 || rolledBack[0].GetTagName() != "stable@v1.27.5+k3s1" || rolledBack[0].Variables["CHANNEL.PREVIOUS"] != "v1.28.2+k3s1" {
+		t.Fatalf("Expected the stable channel moving back to be new, got %v", rolledBack)
+	}
+	if !history.known("testing@v1.28.3-rc1+k3s1") || history.known("stable@v1.28.2+k3s1") {
+		t.Errorf("Expected only the superseded stable version to be forgotten")
+	}
+}
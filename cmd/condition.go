@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// a CEL expression deciding whether a payload is sent for a release, e.g.
+// `RELEASE_PRERELEASE == "false" && RELEASE_ASSETS.exists(a, a.endsWith(".tgz"))`
+//
+// the payload variables are available with their dots replaced by underscores (RELEASE.TAGNAME as RELEASE_TAGNAME)
+// along with RELEASE_ASSETS, the names of the release assets
+type Condition struct {
+	sync.Mutex
+	expression string
+	env        *cel.Env
+	ast        *cel.Ast
+	// the checked programs keyed by the variables they were checked against, as which variables exist depends on the source
+	programs map[string]cel.Program
+}
+
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	var expression string
+	if err := json.Unmarshal(data, &expression); err != nil {
+		return err
+	}
+	env, err := cel.NewEnv(cel.Variable("RELEASE_ASSETS", cel.ListType(cel.StringType)))
+	if err != nil {
+		return err
+	}
+	// only the syntax can be checked up front, the variables are checked once they are known
+	ast, issues := env.Parse(expression)
+	if issues.Err() != nil {
+		return fmt.Errorf("invalid condition %q: %v", expression, issues.Err())
+	}
+	c.expression = expression
+	c.env = env
+	c.ast = ast
+	c.programs = make(map[string]cel.Program)
+	return nil
+}
+
+func (c *Condition) String() string {
+	return c.expression
+}
+
+// returns the program of the condition checked against the variables, checking it on first use of the variable set
+func (c *Condition) program(identifiers []string) (cel.Program, error) {
+	key := strings.Join(identifiers, ",")
+	c.Lock()
+	defer c.Unlock()
+	if program, ok := c.programs[key]; ok {
+		return program, nil
+	}
+	var options []cel.EnvOption
+	for _, identifier := range identifiers {
+		options = append(options, cel.Variable(identifier, cel.StringType))
+	}
+	env, err := c.env.Extend(options...)
+	if err != nil {
+		return nil, err
+	}
+	checked, issues := env.Check(c.ast)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if checked.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("condition evaluates to %s instead of bool", checked.OutputType())
+	}
+	program, err := env.Program(checked)
+	if err != nil {
+		return nil, err
+	}
+	c.programs[key] = program
+	return program, nil
+}
+
+// evaluates the condition against the payload variables and assets of a release
+func (c *Condition) evaluate(variables map[string]string, assets []string) (bool, error) {
+	activation := map[string]interface{}{"RELEASE_ASSETS": assets}
+	identifiers := make([]string, 0, len(variables))
+	for name, value := range variables {
+		identifier := strings.ReplaceAll(name, ".", "_")
+		identifiers = append(identifiers, identifier)
+		activation[identifier] = value
+	}
+	sort.Strings(identifiers)
+	program, err := c.program(identifiers)
+	if err != nil {
+		return false, err
+	}
+	result, _, err := program.Eval(activation)
+	if err != nil {
+		return false, err
+	}
+	return result.Value() == true, nil
+}
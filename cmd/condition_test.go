@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	var payload PayloadEntry
+	if err := json.Unmarshal([]byte(`{"when": "RELEASE_PRERELEASE == \"false\" && RELEASE_ASSETS.exists(a, a.endsWith(\".tgz\"))"}`), &payload); err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	tests := []struct {
+		prerelease string
+		assets     []string
+		expected   bool
+	}{
+		{"false", []string{"chart-1.0.0.tgz", "sha256sum.txt"}, true},
+		{"true", []string{"chart-1.0.0.tgz"}, false},
+		{"false", []string{"sha256sum.txt"}, false},
+		{"false", nil, false},
+	}
+	for _, test := range tests {
+		met, err := payload.When.evaluate(map[string]string{"RELEASE.PRERELEASE": test.prerelease, "RELEASE.TAGNAME": "v1.0.0"}, test.assets)
+		if err != nil {
+			t.Fatalf("Failed to evaluate condition: %v", err)
+		}
+		if met != test.expected {
+			t.Errorf("Expected condition for prerelease %s with assets %v to be %t", test.prerelease, test.assets, test.expected)
+		}
+	}
+
+	if len(payload.When.programs) != 1 {
+		t.Errorf("Expected the condition to be checked once for the variable set, got %d programs", len(payload.When.programs))
+	}
+	if _, err := payload.When.evaluate(map[string]string{"RELEASE.PRERELEASE": "false", "CHART.NAME": "rancher"}, nil); err != nil {
+		t.Fatalf("Failed to evaluate condition: %v", err)
+	}
+	if len(payload.When.programs) != 2 {
+		t.Errorf("Expected the condition to be checked again for another variable set, got %d programs", len(payload.When.programs))
+	}
+
+	var condition Condition
+	if err := json.Unmarshal([]byte(`"RELEASE_TAGNAME.startsWith("`), &condition); err == nil {
+		t.Errorf("Expected a syntax error to fail parsing")
+	}
+	if err := json.Unmarshal([]byte(`"CHART_NAME == \"rancher\""`), &condition); err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	if _, err := condition.evaluate(map[string]string{"RELEASE.TAGNAME": "v1.0.0"}, nil); err == nil {
+		t.Errorf("Expected a variable the release doesn't have to fail evaluation")
+	}
+	if err := json.Unmarshal([]byte(`"RELEASE_TAGNAME"`), &condition); err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	if _, err := condition.evaluate(map[string]string{"RELEASE.TAGNAME": "v1.0.0"}, nil); err == nil {
+		t.Errorf("Expected a condition not evaluating to bool to fail evaluation")
+	}
+}
+
+func TestSendAllPayloadsCondition(t *testing.T) {
+	received := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer ts.Close()
+
+	var payloads []PayloadEntry
+	if err := json.Unmarshal([]byte(`[
+		{"name": "ga", "url": "`+ts.URL+`", "payload": {"tag": "$RELEASE.TAGNAME"}, "when": "RELEASE_PRERELEASE == \"false\""},
+		{"name": "any", "url": "`+ts.URL+`", "payload": {"tag": "$RELEASE.TAGNAME"}}
+	]`), &payloads); err != nil {
+		t.Fatalf("Failed to parse payloads: %v", err)
+	}
+	repo := RepositoryEntry{Repo: "rancher", Payloads: PayloadMap{"ga": true, "any": true}}
+	release := &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String("v2.8.0-rc1"), Prerelease: github.Bool(true)}}
+	if err := sendAllPayloads(release, repo, payloads); err != nil {
+		t.Fatalf("Failed to send payloads: %v", err)
+	}
+	if received != 1 {
+		t.Errorf("Expected only the unconditional payload to be sent for a prerelease, got %d", received)
+	}
+}
@@ -2,17 +2,56 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	log "github.com/sirupsen/logrus"
 )
 
+// supported values for the source field of a RepositoryEntry
+const (
+	SourceGithub   = "github"
+	SourceGitlab   = "gitlab"
+	SourceGitea    = "gitea"
+	SourceForgejo  = "forgejo"
+	SourceOCI      = "oci"
+	SourceHelm     = "helm"
+	SourceChannels = "channels"
+	SourceFeed     = "feed"
+	SourceGoProxy  = "goproxy"
+	SourceGit      = "git"
+)
+
 type RepositoryEntry struct {
-	Owner       string     `json:"owner"`
-	Repo        string     `json:"repo"`
-	Prereleases bool       `json:"prereleases"`
-	Payloads    PayloadMap `json:"payloads"`
-	Slack       bool       `json:"slack"`
+	Source              string          `json:"source"`
+	Url                 string          `json:"url"`
+	UploadUrl           string          `json:"uploadUrl"`
+	TokenEnv            string          `json:"tokenEnv"`
+	Owner               string          `json:"owner"`
+	Repo                string          `json:"repo"`
+	Mode                string          `json:"mode"`
+	TagAnnotations      bool            `json:"tagAnnotations"`
+	Channels            []string        `json:"channels"`
+	Versions            *VersionRange   `json:"versions"`
+	Include             Patterns        `json:"include"`
+	Exclude             Patterns        `json:"exclude"`
+	FilterNames         bool            `json:"filterNames"`
+	ClassifyPrereleases bool            `json:"classifyPrereleases"`
+	PrereleasePatterns  Patterns        `json:"prereleasePatterns"`
+	Policy              Policy          `json:"policy"`
+	Assets              []string        `json:"assets"`
+	AssetTimeout        int             `json:"assetTimeout"`
+	Discover            *DiscoveryEntry `json:"discover"`
+	Prereleases         bool            `json:"prereleases"`
+	Payloads            PayloadMap      `json:"payloads"`
+	Slack               bool            `json:"slack"`
+	SlackEvents         []string        `json:"slackEvents"`
+	// the position of the entry in the repo config, telling apart entries monitoring the same repo
+	entry int
 }
 
 type PayloadMap map[string]bool
@@ -21,6 +60,9 @@ type PayloadEntry struct {
 	Name    string          `json:"name"`
 	Url     string          `json:"url"`
 	Payload json.RawMessage `json:"payload"`
+	Events  []string        `json:"events"`
+	Policy  Policy          `json:"policy"`
+	When    *Condition      `json:"when"`
 }
 
 func (p *PayloadMap) UnmarshalJSON(data []byte) error {
@@ -38,6 +80,180 @@ func (p *PayloadMap) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// a regular expression, compiled when the config is loaded (nil when unset)
+type Pattern struct {
+	*regexp.Regexp
+}
+
+func (p *Pattern) UnmarshalJSON(data []byte) error {
+	var expression string
+	if err := json.Unmarshal(data, &expression); err != nil {
+		return err
+	}
+	if expression == "" {
+		*p = Pattern{}
+		return nil
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", expression, err)
+	}
+	*p = Pattern{pattern}
+	return nil
+}
+
+// regular expressions, compiled when the config is loaded
+type Patterns []*regexp.Regexp
+
+func (p *Patterns) UnmarshalJSON(data []byte) error {
+	var expressions []string
+	if err := json.Unmarshal(data, &expressions); err != nil {
+		return err
+	}
+	patterns := make(Patterns, 0, len(expressions))
+	for _, expression := range expressions {
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", expression, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	*p = patterns
+	return nil
+}
+
+// returns the first pattern matching any of the values, nil if none does
+func (p Patterns) match(values ...string) *regexp.Regexp {
+	for _, pattern := range p {
+		for _, value := range values {
+			if pattern.MatchString(value) {
+				return pattern
+			}
+		}
+	}
+	return nil
+}
+
+// a semver constraint on the versions of a repository actions are run for, e.g. ">=2.8.0 <2.10.0"
+type VersionRange struct {
+	constraints *semver.Constraints
+	raw         string
+}
+
+func (v *VersionRange) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	constraints, err := semver.NewConstraint(raw)
+	if err != nil {
+		return fmt.Errorf("invalid version constraint %q: %v", raw, err)
+	}
+	*v = VersionRange{constraints: constraints, raw: raw}
+	return nil
+}
+
+func (v *VersionRange) String() string {
+	return v.raw
+}
+
+// checks whether the tag is a version within the range, tolerating `v` prefixes and build metadata (e.g. `+k3s1`)
+//
+// prereleases are checked by the version they precede, so v2.9.0-rc1 is within ">=2.8.0 <2.10.0"
+func (v *VersionRange) contains(tag string) bool {
+	version, err := semver.NewVersion(tag)
+	if err != nil {
+		return false
+	}
+	if version.Prerelease() != "" {
+		withoutPrerelease, err := version.SetPrerelease("")
+		if err != nil {
+			return false
+		}
+		version = &withoutPrerelease
+	}
+	return v.constraints.Check(version)
+}
+
+// returns the source of the repository, defaulting to github when unspecified
+func (r RepositoryEntry) source() string {
+	if r.Source == "" {
+		return SourceGithub
+	}
+	return r.Source
+}
+
+// returns the base web url of the host serving the repository
+func (r RepositoryEntry) webURL() string {
+	switch r.source() {
+	case SourceGitlab:
+		if r.Url != "" {
+			return strings.TrimSuffix(r.Url, "/")
+		}
+		return "https://gitlab.com"
+	case SourceGitea, SourceForgejo:
+		if r.Url != "" {
+			return strings.TrimSuffix(r.Url, "/")
+		}
+		if r.source() == SourceForgejo {
+			return "https://codeberg.org"
+		}
+		return "https://gitea.com"
+	case SourceOCI:
+		if r.Url != "" {
+			return strings.TrimSuffix(r.Url, "/")
+		}
+		return "https://registry-1.docker.io"
+	case SourceGoProxy:
+		if r.Url != "" {
+			return strings.TrimSuffix(r.Url, "/")
+		}
+		return "https://proxy.golang.org"
+	case SourceHelm, SourceFeed, SourceGit:
+		return strings.TrimSuffix(r.Url, "/")
+	case SourceChannels:
+		if r.Url != "" {
+			return strings.TrimSuffix(r.Url, "/")
+		}
+		return "https://update.k3s.io/v1-release/channels"
+	default:
+		if r.Url == "" {
+			return "https://github.com"
+		}
+		// enterprise api urls look like https://[hostname]/api/v3/ (or https://api.[hostname]/)
+		u, err := url.Parse(r.Url)
+		if err != nil {
+			return strings.TrimSuffix(r.Url, "/")
+		}
+		u.Host = strings.TrimPrefix(u.Host, "api.")
+		u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/v3")
+		return strings.TrimSuffix(u.String(), "/")
+	}
+}
+
+// returns the owner/repo name of the repository, leaving out whichever parts aren't set
+func (r RepositoryEntry) fullName() string {
+	switch {
+	case r.Owner != "" && r.Repo != "":
+		return fmt.Sprintf("%s/%s", r.Owner, r.Repo)
+	case r.Repo != "":
+		return r.Repo
+	case r.Owner != "":
+		return r.Owner
+	default:
+		return r.webURL()
+	}
+}
+
+// returns the ssh url of the repository
+func (r RepositoryEntry) sshURL() string {
+	host := "github.com"
+	if u, err := url.Parse(r.webURL()); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return fmt.Sprintf("git@%s:%s/%s", host, r.Owner, r.Repo)
+}
+
 // sources env var RELEASEBOT_REPOS for all RepositoryEntries
 func loadRepos(config *[]RepositoryEntry) error {
 
@@ -59,6 +275,9 @@ func loadRepos(config *[]RepositoryEntry) error {
 	if err != nil {
 		return err
 	}
+	for i := range *config {
+		(*config)[i].entry = i
+	}
 
 	return nil
 }
@@ -5,12 +5,31 @@ import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"strings"
 )
 
 var DataFolderPath = fmt.Sprintf("%s/data", os.Getenv("PWD"))
 
 const ReleaseFileFormat = "%s/%s-%s"
 
+// returns the path of the release history file for a repo
+//
+// github repos keep the plain owner-repo naming, enterprise repos are prefixed with their host,
+// other sources are prefixed with the source name and any slashes in the owner (e.g. gitlab subgroups) are flattened
+func releaseHistoryFilePath(repo RepositoryEntry) string {
+	owner := strings.ReplaceAll(repo.Owner, "/", "-")
+	if owner == "" {
+		// sources like helm chart repositories are only identified by their url
+		owner = strings.ReplaceAll(strings.TrimPrefix(strings.TrimPrefix(repo.webURL(), "https://"), "http://"), "/", "-")
+	}
+	if repo.source() != SourceGithub {
+		owner = fmt.Sprintf("%s-%s", repo.source(), owner)
+	} else if repo.Url != "" {
+		owner = fmt.Sprintf("%s-%s", strings.TrimPrefix(strings.TrimPrefix(repo.webURL(), "https://"), "http://"), owner)
+	}
+	return fmt.Sprintf(ReleaseFileFormat, DataFolderPath, owner, repo.Repo)
+}
+
 func ensureDataFolder(folderPath string) error {
 	fileInfo, err := os.Stat(folderPath)
 	if os.IsNotExist(err) {
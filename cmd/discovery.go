@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// minutes between discovery runs when not specified
+const defaultDiscoveryInterval = 60
+
+type DiscoveryEntry struct {
+	Topic           string  `json:"topic"`
+	Match           Pattern `json:"match"`
+	IncludeArchived bool    `json:"includeArchived"`
+	IncludeForks    bool    `json:"includeForks"`
+	Interval        int     `json:"interval"`
+}
+
+// lists all repos of the entry's owner (an organization or a user) and expands the ones passing the
+// discovery filters into concrete repo entries sharing the rest of the entry's configuration
+func discoverRepos(entry RepositoryEntry) ([]RepositoryEntry, error) {
+	if entry.source() != SourceGithub {
+		return nil, fmt.Errorf("repository discovery is not supported for repository source %q", entry.source())
+	}
+	allRepos, err := listOwnerRepos(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []RepositoryEntry
+	for _, repo := range allRepos {
+		if discoveryMatches(entry, repo) {
+			discovered = append(discovered, discoveredRepo(entry, repo))
+		}
+	}
+	return discovered, nil
+}
+
+// checks whether a repo passes the discovery filters of an entry
+func discoveryMatches(entry RepositoryEntry, repo *github.Repository) bool {
+	if !entry.Discover.IncludeArchived && repo.GetArchived() {
+		return false
+	}
+	if !entry.Discover.IncludeForks && repo.GetFork() {
+		return false
+	}
+	if entry.Discover.Match.Regexp != nil && !entry.Discover.Match.MatchString(repo.GetName()) {
+		return false
+	}
+	return entry.Discover.Topic == "" || hasTopic(repo, entry.Discover.Topic)
+}
+
+// the concrete repo entry of a discovered repo
+func discoveredRepo(entry RepositoryEntry, repo *github.Repository) RepositoryEntry {
+	concrete := entry
+	concrete.Repo = repo.GetName()
+	concrete.Discover = nil
+	return concrete
+}
+
+// lists the repos of an organization, falling back to listing those of a user if no such organization exists
+func listOwnerRepos(entry RepositoryEntry) ([]*github.Repository, error) {
+	client, err := newGithubClient(entry)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	var allRepos []*github.Repository
+	orgOpt := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		repos, resp, err := client.Repositories.ListByOrg(ctx, entry.Owner, orgOpt)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				break
+			}
+			return nil, err
+		}
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			return allRepos, nil
+		}
+		orgOpt.Page = resp.NextPage
+	}
+
+	userOpt := &github.RepositoryListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		repos, resp, err := client.Repositories.List(ctx, entry.Owner, userOpt)
+		if err != nil {
+			return nil, err
+		}
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			return allRepos, nil
+		}
+		userOpt.Page = resp.NextPage
+	}
+}
+
+func hasTopic(repo *github.Repository, topic string) bool {
+	for _, t := range repo.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// the monitors of discovered repos keyed by repo name, so they can be stopped once a repo disappears
+type discoveredMonitors struct {
+	sync.Mutex
+	cancels map[string]context.CancelFunc
+	start   func(ctx context.Context, repo RepositoryEntry)
+}
+
+func newDiscoveredMonitors(start func(ctx context.Context, repo RepositoryEntry)) *discoveredMonitors {
+	return &discoveredMonitors{
+		cancels: make(map[string]context.CancelFunc),
+		start:   start,
+	}
+}
+
+// starts monitors for newly discovered repos and stops those of repos that are no longer discovered
+func (m *discoveredMonitors) reconcile(repos []RepositoryEntry) (started []string, stopped []string) {
+	m.Lock()
+	defer m.Unlock()
+	current := make(map[string]bool)
+	for _, repo := range repos {
+		current[repo.Repo] = true
+		if _, ok := m.cancels[repo.Repo]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancels[repo.Repo] = cancel
+		m.start(ctx, repo)
+		started = append(started, repo.Repo)
+	}
+	for name, cancel := range m.cancels {
+		if !current[name] {
+			cancel()
+			delete(m.cancels, name)
+			stopped = append(stopped, name)
+		}
+	}
+	return started, stopped
+}
+
+// periodically expands a discovery entry into repos and keeps a monitor running for each of them
+//
+// newly discovered repos are baselined like any other repo on startup, so their existing releases don't trigger actions
+func monitorDiscovery(entry RepositoryEntry, payloads []PayloadEntry) {
+	interval := entry.Discover.Interval
+	if interval <= 0 {
+		interval = defaultDiscoveryInterval
+	}
+	monitors := newDiscoveredMonitors(func(ctx context.Context, repo RepositoryEntry) {
+		startRepoMonitors(ctx, repo, payloads)
+	})
+	for {
+		repos, err := discoverRepos(entry)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"owner": entry.Owner,
+				"error": err,
+			}).Error("Failed to discover repositories")
+		} else {
+			started, stopped := monitors.reconcile(repos)
+			for _, name := range started {
+				log.WithFields(log.Fields{
+					"owner": entry.Owner,
+					"repo":  name,
+				}).Info("Discovered repository, starting monitor")
+			}
+			for _, name := range stopped {
+				log.WithFields(log.Fields{
+					"owner": entry.Owner,
+					"repo":  name,
+				}).Info("Repository no longer discovered, stopping monitor")
+			}
+		}
+		time.Sleep(time.Duration(interval) * time.Minute)
+	}
+}
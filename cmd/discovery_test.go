@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestDiscoverRepos(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/orgs/rancher/repos":
+			fmt.Fprint(w, `[
+				{"name": "rke2", "topics": ["kubernetes", "rke2"]},
+				{"name": "rke2-charts", "topics": ["helm"]},
+				{"name": "rke2-old", "archived": true, "topics": ["kubernetes"]},
+				{"name": "rke2-fork", "fork": true, "topics": ["kubernetes"]},
+				{"name": "rancher", "topics": ["kubernetes"]}
+			]`)
+		case "/api/v3/orgs/clanktron/repos":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		case "/api/v3/users/clanktron/repos":
+			fmt.Fprint(w, `[{"name": "dummy"}]`)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	entry := RepositoryEntry{
+		Url:      ts.URL,
+		Owner:    "rancher",
+		Slack:    true,
+		Payloads: PayloadMap{"standard": true},
+		Discover: &DiscoveryEntry{
+			Topic: "kubernetes",
+			Match: Pattern{regexp.MustCompile("^rke2")},
+		},
+	}
+	repos, err := discoverRepos(entry)
+	if err != nil {
+		t.Fatalf("Failed to discover repos: %v", err)
+	}
+	if len(repos) != 1 || repos[0].Repo != "rke2" {
+		t.Fatalf("Expected only rke2 to be discovered, got %v", repos)
+	}
+	if repos[0].Owner != "rancher" || !repos[0].Slack || !repos[0].Payloads["standard"] || repos[0].Discover != nil {
+		t.Errorf("Expected discovered repo to inherit the entry configuration")
+	}
+
+	entry.Discover = &DiscoveryEntry{Topic: "kubernetes", IncludeArchived: true, IncludeForks: true}
+	repos, err = discoverRepos(entry)
+	if err != nil {
+		t.Fatalf("Failed to discover repos: %v", err)
+	}
+	if len(repos) != 4 {
+		t.Errorf("Expected archived and forked repos to be included, got %d repos", len(repos))
+	}
+
+	entry.Owner = "clanktron"
+	entry.Discover = &DiscoveryEntry{}
+	repos, err = discoverRepos(entry)
+	if err != nil {
+		t.Fatalf("Failed to discover user repos: %v", err)
+	}
+	if len(repos) != 1 || repos[0].Repo != "dummy" {
+		t.Errorf("Expected user repos to be listed when no organization exists, got %v", repos)
+	}
+}
+
+func TestDiscoveredMonitorsReconcile(t *testing.T) {
+	running := make(map[string]context.Context)
+	monitors := newDiscoveredMonitors(func(ctx context.Context, repo RepositoryEntry) {
+		running[repo.Repo] = ctx
+	})
+
+	started, stopped := monitors.reconcile([]RepositoryEntry{{Repo: "a"}, {Repo: "b"}})
+	sort.Strings(started)
+	if !reflect.DeepEqual(started, []string{"a", "b"}) || len(stopped) != 0 {
+		t.Errorf("Expected a and b to be started, got started %v stopped %v", started, stopped)
+	}
+
+	started, stopped = monitors.reconcile([]RepositoryEntry{{Repo: "b"}, {Repo: "c"}})
+	if !reflect.DeepEqual(started, []string{"c"}) || !reflect.DeepEqual(stopped, []string{"a"}) {
+		t.Errorf("Expected c to be started and a to be stopped, got started %v stopped %v", started, stopped)
+	}
+	if running["a"].Err() == nil {
+		t.Errorf("Expected monitor of a to be cancelled")
+	}
+	if running["b"].Err() != nil || running["c"].Err() != nil {
+		t.Errorf("Expected monitors of b and c to keep running")
+	}
+}
+
+func TestDiscoveryMatchParsing(t *testing.T) {
+	var entry RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"owner": "rancher", "discover": {"match": "^rke2"}}`), &entry); err != nil {
+		t.Fatalf("Failed to parse discovery entry: %v", err)
+	}
+	if entry.Discover.Match.Regexp == nil || !entry.Discover.Match.MatchString("rke2-charts") {
+		t.Errorf("Expected the match expression to be compiled when parsing")
+	}
+	if err := json.Unmarshal([]byte(`{"owner": "rancher", "discover": {"match": "("}}`), &entry); err == nil {
+		t.Errorf("Expected an invalid match expression to fail parsing")
+	}
+}
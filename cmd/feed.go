@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// date layouts seen in the wild for rss pubDate and atom updated/published elements
+var feedDateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+type atomFeed struct {
+	Entries []struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Publish string `xml:"published"`
+		Content string `xml:"content"`
+		Summary string `xml:"summary"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Author struct {
+			Name string `xml:"name"`
+			URI  string `xml:"uri"`
+		} `xml:"author"`
+	} `xml:"entry"`
+}
+
+type rssFeed struct {
+	Channel struct {
+		Items []struct {
+			GUID        string `xml:"guid"`
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			PubDate     string `xml:"pubDate"`
+			Description string `xml:"description"`
+			Author      string `xml:"author"`
+			Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// a feed entry reduced to what is mapped onto a release
+type feedEntry struct {
+	id        string
+	title     string
+	link      string
+	updated   string
+	body      string
+	author    string
+	authorURL string
+}
+
+func parseFeedDate(date string) *github.Timestamp {
+	date = strings.TrimSpace(date)
+	for _, layout := range feedDateLayouts {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return &github.Timestamp{Time: parsed}
+		}
+	}
+	return nil
+}
+
+// parses an atom or rss 2.0 document into its entries
+func parseFeed(document []byte) ([]feedEntry, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(document, &root); err != nil {
+		return nil, err
+	}
+
+	var entries []feedEntry
+	switch root.XMLName.Local {
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(document, &feed); err != nil {
+			return nil, err
+		}
+		for _, entry := range feed.Entries {
+			link := ""
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			updated := entry.Updated
+			if updated == "" {
+				updated = entry.Publish
+			}
+			body := entry.Content
+			if body == "" {
+				body = entry.Summary
+			}
+			entries = append(entries, feedEntry{
+				id:        entry.ID,
+				title:     entry.Title,
+				link:      link,
+				updated:   updated,
+				body:      body,
+				author:    entry.Author.Name,
+				authorURL: entry.Author.URI,
+			})
+		}
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(document, &feed); err != nil {
+			return nil, err
+		}
+		for _, item := range feed.Channel.Items {
+			author := item.Author
+			if author == "" {
+				author = item.Creator
+			}
+			entries = append(entries, feedEntry{
+				id:      item.GUID,
+				title:   item.Title,
+				link:    item.Link,
+				updated: item.PubDate,
+				body:    item.Description,
+				author:  author,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed format %q", root.XMLName.Local)
+	}
+	return entries, nil
+}
+
+// fetches the entries of an atom or rss feed as releases
+//
+// entries are de-duplicated by their id/guid (falling back to the link, then the title) which serves as the tag name,
+// $RELEASE.TAGNAME is the entry title and entries whose title carries a semver prerelease identifier are prereleases
+func getAllFeedReleases(repo RepositoryEntry) ([]*Release, error) {
+	req, err := http.NewRequest("GET", repo.webURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/atom+xml, application/rss+xml, application/xml;q=0.9, */*;q=0.8")
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %s for %s", resp.Status, repo.webURL())
+	}
+	document, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseFeed(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []*Release
+	for _, entry := range entries {
+		id := strings.TrimSpace(entry.id)
+		if id == "" {
+			id = strings.TrimSpace(entry.link)
+		}
+		if id == "" {
+			id = strings.TrimSpace(entry.title)
+		}
+		if id == "" {
+			continue
+		}
+		title := strings.TrimSpace(entry.title)
+		releases = append(releases, &Release{
+			RepositoryRelease: &github.RepositoryRelease{
+				TagName:     github.String(id),
+				Name:        github.String(title),
+				Body:        github.String(entry.body),
+				Draft:       github.Bool(false),
+				Prerelease:  github.Bool(isPrereleaseTag(title)),
+				HTMLURL:     github.String(strings.TrimSpace(entry.link)),
+				PublishedAt: parseFeedDate(entry.updated),
+				Author: &github.User{
+					Login:   github.String(entry.author),
+					HTMLURL: github.String(entry.authorURL),
+				},
+			},
+			Variables: map[string]string{
+				"RELEASE.TAGNAME": title,
+			},
+		})
+	}
+	return releases, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAtomFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" xml:lang="en-US">
+  <id>tag:github.com,2008:https://github.com/rancher/rancher/releases</id>
+  <title>Release notes from rancher</title>
+  <updated>2023-09-20T12:00:00Z</updated>
+  <entry>
+    <id>tag:github.com,2008:Repository/34526213/v2.8.0-rc1</id>
+    <updated>2023-09-20T12:00:00Z</updated>
+    <link rel="alternate" type="text/html" href="https://github.com/rancher/rancher/releases/tag/v2.8.0-rc1"/>
+    <title>v2.8.0-rc1</title>
+    <content type="html">&lt;p&gt;Release candidate&lt;/p&gt;</content>
+    <author><name>rancher-max</name></author>
+  </entry>
+  <entry>
+    <id>tag:github.com,2008:Repository/34526213/v2.7.6</id>
+    <updated>2023-08-31T18:00:00Z</updated>
+    <link rel="alternate" type="text/html" href="https://github.com/rancher/rancher/releases/tag/v2.7.6"/>
+    <title>v2.7.6</title>
+    <content type="html">&lt;p&gt;Patch release&lt;/p&gt;</content>
+    <author><name>rancher-max</name><uri>https://github.com/rancher-max</uri></author>
+  </entry>
+</feed>`
+
+const testRSSFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel>
+    <title>Vendor announcements</title>
+    <item>
+      <title>Product 4.2 released</title>
+      <link>https://vendor.example.com/blog/product-4-2</link>
+      <guid isPermaLink="false">announcement-1042</guid>
+      <pubDate>Tue, 03 Oct 2023 09:30:00 +0000</pubDate>
+      <description>Product 4.2 is out</description>
+      <dc:creator>Release Team</dc:creator>
+    </item>
+    <item>
+      <title>Maintenance window</title>
+      <link>https://vendor.example.com/blog/maintenance</link>
+      <pubDate>Mon, 2 Oct 2023 08:00:00 GMT</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+func TestGetAllFeedReleases(t *testing.T) {
+	feeds := map[string]string{
+		"/releases.atom": testAtomFeed,
+		"/feed.rss":      testRSSFeed,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, feeds[r.URL.Path])
+	}))
+	defer server.Close()
+
+	atomRepo := RepositoryEntry{Source: SourceFeed, Url: server.URL + "/releases.atom", Owner: "rancher", Repo: "rancher"}
+	releases, err := getLatestReleases(atomRepo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get atom releases: %v", err)
+	}
+	if len(releases) != 1 {
+		t.Fatalf("Expected 1 atom release, got %d", len(releases))
+	}
+	release := releases[0]
+	if release.GetTagName() != "tag:github.com,2008:Repository/34526213/v2.7.6" || release.Variables["RELEASE.TAGNAME"] != "v2.7.6" {
+		t.Errorf("Unexpected atom release %s (%s)", release.GetTagName(), release.Variables["RELEASE.TAGNAME"])
+	}
+	if release.GetHTMLURL() != "https://github.com/rancher/rancher/releases/tag/v2.7.6" || release.Author.GetLogin() != "rancher-max" {
+		t.Errorf("Unexpected atom link %s or author %s", release.GetHTMLURL(), release.Author.GetLogin())
+	}
+	if !release.GetPublishedAt().Time.Equal(time.Date(2023, 8, 31, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected atom updated time %v", release.GetPublishedAt())
+	}
+	prereleases, err := getLatestReleases(atomRepo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get atom prereleases: %v", err)
+	}
+	if len(prereleases) != 1 || prereleases[0].GetName() != "v2.8.0-rc1" {
+		t.Errorf("Expected v2.8.0-rc1 to be classified as a prerelease")
+	}
+
+	rssRepo := RepositoryEntry{Source: SourceFeed, Url: server.URL + "/feed.rss", Repo: "vendor"}
+	releases, err = getLatestReleases(rssRepo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get rss releases: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("Expected 2 rss releases, got %d", len(releases))
+	}
+	if releases[0].GetTagName() != "announcement-1042" || releases[0].Author.GetLogin() != "Release Team" {
+		t.Errorf("Expected the newest item to be keyed by its guid, got %s", releases[0].GetTagName())
+	}
+	if releases[1].GetTagName() != "https://vendor.example.com/blog/maintenance" {
+		t.Errorf("Expected an item without guid to be keyed by its link, got %s", releases[1].GetTagName())
+	}
+
+	loadedReleasesMap := map[string]bool{"announcement-1042": true}
+	newReleases := checkForNewReleases(releases, loadedReleasesMap)
+	if len(newReleases) != 1 || newReleases[0].GetName() != "Maintenance window" {
+		t.Errorf("Expected only the unseen item to be new")
+	}
+}
+
+func TestFeedEntriesAgingOut(t *testing.T) {
+	feed := testAtomFeed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, feed)
+	}))
+	defer server.Close()
+
+	repo := RepositoryEntry{Source: SourceFeed, Url: server.URL, Owner: "rancher", Repo: "aging"}
+	history := getReleaseHistory(repo)
+	releases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get feed releases: %v", err)
+	}
+	history.checkForNewReleases(releases)
+
+	// v2.7.6 drops out of the feed window once newer entries are published
+	feed = strings.Replace(testAtomFeed, "<title>v2.7.6</title>", "<title>v2.7.7</title>", 1)
+	feed = strings.Replace(feed, "Repository/34526213/v2.7.6", "Repository/34526213/v2.7.7", 1)
+	for poll := 0; poll < changeConfirmations+1; poll++ {
+		releases, err := getLatestReleases(repo, false, -1)
+		if err != nil {
+			t.Fatalf("Failed to get feed releases: %v", err)
+		}
+		history.checkForChangedReleases(releases)
+		if deleted := history.checkForDeletedReleases(releases, false, completeListing(repo, true)); len(deleted) != 0 {
+			t.Fatalf("Expected entries leaving the feed not to be deleted, got %v", deleted)
+		}
+		history.checkForNewReleases(releases)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// number of consecutive polls a release has to be missing (or its tag has to point at another commit)
+// before it is reported as deleted (or retagged), so a single flaky response doesn't raise false alarms
+var changeConfirmations = func() int {
+	confirmations, err := strconv.Atoi(os.Getenv("CHANGE_CONFIRMATIONS"))
+	if err != nil || confirmations < 1 {
+		return 2
+	}
+	return confirmations
+}()
+
+// what a release looked like when last seen, a change of any of it is reported as an edit
+// (or a promotion if the release stopped being a prerelease, a retag if its tag moved to another commit)
+type releaseFingerprint struct {
+	Prerelease bool   `json:"prerelease"`
+	Name       string `json:"name"`
+	BodyHash   string `json:"bodyHash"`
+	// sorted and comma separated asset names
+	Assets string `json:"assets"`
+	// the commit the tag points at (or its tag object), empty if the source doesn't tell
+	Commit string `json:"commit,omitempty"`
+}
+
+// a tag seen pointing at another commit than the fingerprinted one, not yet confirmed
+type suspectedRetag struct {
+	commit string
+	polls  int
+}
+
+var commitSHA = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// returns the commit the tag of the release points at, if known
+//
+// github listings (rest, graphql and tags mode) and git remotes carry it as the target of the release, full rest
+// listings carry the tag object of annotated tags instead (see getGithubTagObjects)
+func releaseCommit(release *Release) string {
+	if commit := release.Variables["RELEASE.COMMIT"]; commit != "" {
+		return commit
+	}
+	if commitSHA.MatchString(release.GetTargetCommitish()) {
+		return release.GetTargetCommitish()
+	}
+	return ""
+}
+
+func fingerprintRelease(release *Release) releaseFingerprint {
+	body := sha256.Sum256([]byte(release.GetBody()))
+	var assets []string
+	for _, asset := range release.Assets {
+		assets = append(assets, asset.GetName())
+	}
+	sort.Strings(assets)
+	return releaseFingerprint{
+		Prerelease: release.GetPrerelease(),
+		Name:       release.GetName(),
+		BodyHash:   hex.EncodeToString(body[:]),
+		Assets:     strings.Join(assets, ","),
+		Commit:     releaseCommit(release),
+	}
+}
+
+// returns the parts of the release that changed between the fingerprints, e.g. `name,body`
+func fingerprintChanges(previous, current releaseFingerprint) []string {
+	var changes []string
+	if previous.Prerelease != current.Prerelease {
+		changes = append(changes, "prerelease")
+	}
+	if previous.Name != current.Name {
+		changes = append(changes, "name")
+	}
+	if previous.BodyHash != current.BodyHash {
+		changes = append(changes, "body")
+	}
+	if previous.Assets != current.Assets {
+		changes = append(changes, "assets")
+	}
+	if previous.Commit != current.Commit {
+		changes = append(changes, "commit")
+	}
+	return changes
+}
+
+// the path of the file the release fingerprints of a repo are persisted in, next to its release history
+func releaseFingerprintsFilePath(repo RepositoryEntry) string {
+	return releaseHistoryFilePath(repo) + ".fingerprints"
+}
+
+// loads the persisted release fingerprints of a repo, releases without one are fingerprinted silently when next seen
+func loadReleaseFingerprints(repo RepositoryEntry) map[string]releaseFingerprint {
+	fingerprints := make(map[string]releaseFingerprint)
+	if !persist {
+		return fingerprints
+	}
+	data, err := os.ReadFile(releaseFingerprintsFilePath(repo))
+	if err != nil {
+		return fingerprints
+	}
+	if err := json.Unmarshal(data, &fingerprints); err != nil {
+		log.WithFields(log.Fields{
+			"repoName": repo.fullName(),
+			"error":    err,
+		}).Warn("Failed to read release fingerprints, fingerprinting releases anew")
+		return make(map[string]releaseFingerprint)
+	}
+	return fingerprints
+}
+
+// persists the release fingerprints of the history, the caller must hold the history lock
+func (h *releaseHistory) saveFingerprints() {
+	if !persist {
+		return
+	}
+	data, err := json.Marshal(h.fingerprints)
+	if err == nil {
+		err = os.WriteFile(releaseFingerprintsFilePath(h.repo), data, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"repoName": h.repo.fullName(),
+			"error":    err,
+		}).Error("Failed to persist release fingerprints")
+	}
+}
+
+// compares the known releases against their fingerprints, returning copies of the ones that changed marked with
+// the retagged (tag moved to another commit), promoted (prerelease turned into a release) or edited event
+//
+// releases still waiting for their assets are only re-fingerprinted, as are known releases seen for the first time,
+// and retags are only reported once the tag was seen at the new commit for changeConfirmations polls in a row
+func (h *releaseHistory) checkForChangedReleases(latestReleases []*Release) []*Release {
+	h.Lock()
+	defer h.Unlock()
+	var changed []*Release
+	updated := false
+	for _, release := range latestReleases {
+		tag := release.GetTagName()
+		if !h.releases[tag] {
+			continue
+		}
+		delete(h.missing, tag)
+		current := fingerprintRelease(release)
+		previous, ok := h.fingerprints[tag]
+		if ok && previous.Commit == "" {
+			// fingerprinted before its commit was known
+			previous.Commit = current.Commit
+		}
+		resolved := current.Commit != ""
+		if ok && !resolved {
+			// the commit isn't known this time (e.g. an incremental rest listing), a suspected retag stays suspected
+			current.Commit = previous.Commit
+		}
+		if ok && previous == current {
+			if resolved {
+				delete(h.retags, tag)
+			}
+			if h.fingerprints[tag] != current {
+				h.fingerprints[tag] = current
+				updated = true
+			}
+			continue
+		}
+		event := EventEdited
+		switch {
+		case ok && current.Commit != "" && previous.Commit != current.Commit:
+			suspect := h.retags[tag]
+			if suspect.commit != current.Commit {
+				suspect = suspectedRetag{commit: current.Commit}
+			}
+			suspect.polls++
+			if suspect.polls < changeConfirmations {
+				h.retags[tag] = suspect
+				continue
+			}
+			delete(h.retags, tag)
+			event = EventRetagged
+		case previous.Prerelease && !current.Prerelease:
+			event = EventPromoted
+		}
+		h.fingerprints[tag] = current
+		updated = true
+		if _, pending := h.pending[tag]; !ok || pending {
+			continue
+		}
+		variables := map[string]string{"RELEASE.CHANGES": strings.Join(fingerprintChanges(previous, current), ",")}
+		for name, value := range release.Variables {
+			variables[name] = value
+		}
+		if event == EventRetagged {
+			variables["RELEASE.COMMIT"] = current.Commit
+			variables["RELEASE.PREVIOUSCOMMIT"] = previous.Commit
+		}
+		changed = append(changed, &Release{RepositoryRelease: release.RepositoryRelease, Variables: variables, Event: event})
+	}
+	if updated {
+		h.saveFingerprints()
+	}
+	return changed
+}
+
+// compares a complete listing of the releases (or prereleases) against the fingerprinted ones, returning the releases
+// that were missing from it for changeConfirmations polls in a row marked with the deleted event
+//
+// incomplete listings (see completeListing) can't tell deleted releases from ones that are merely not listed,
+// so nothing is deleted for them. deleted releases stay known, so they aren't reported as new should they reappear
+func (h *releaseHistory) checkForDeletedReleases(latestReleases []*Release, prerelease bool, complete bool) []*Release {
+	if !complete {
+		return nil
+	}
+	h.Lock()
+	defer h.Unlock()
+	listed := make(map[string]bool)
+	for _, release := range latestReleases {
+		listed[release.GetTagName()] = true
+	}
+	var deleted []*Release
+	for tag, fingerprint := range h.fingerprints {
+		// promoted prereleases move from one listing to the other
+		if listed[tag] || fingerprint.Prerelease != prerelease {
+			continue
+		}
+		if _, pending := h.pending[tag]; pending {
+			continue
+		}
+		h.missing[tag]++
+		if h.missing[tag] < changeConfirmations {
+			continue
+		}
+		delete(h.missing, tag)
+		delete(h.fingerprints, tag)
+		delete(h.retags, tag)
+		deleted = append(deleted, &Release{
+			RepositoryRelease: &github.RepositoryRelease{
+				TagName:    github.String(tag),
+				Name:       github.String(fingerprint.Name),
+				Prerelease: github.Bool(fingerprint.Prerelease),
+			},
+			Variables: map[string]string{"RELEASE.COMMIT": fingerprint.Commit},
+			Event:     EventDeleted,
+		})
+	}
+	if len(deleted) > 0 {
+		h.saveFingerprints()
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].GetTagName() < deleted[j].GetTagName()
+	})
+	return deleted
+}
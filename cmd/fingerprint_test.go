@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func testFingerprintRelease(tag string, prerelease bool, body string) *Release {
+	return &Release{RepositoryRelease: &github.RepositoryRelease{
+		TagName:    github.String(tag),
+		Name:       github.String(tag),
+		Body:       github.String(body),
+		Prerelease: github.Bool(prerelease),
+	}}
+}
+
+func TestCheckForChangedReleases(t *testing.T) {
+	history := getReleaseHistory(RepositoryEntry{Owner: "fingerprint", Repo: "changes"})
+	history.merge(map[string]bool{"v0.9.0": true})
+	if newReleases := history.checkForNewReleases([]*Release{testFingerprintRelease("v1.0.0-rc1", true, "notes")}); len(newReleases) != 1 {
+		t.Fatalf("Expected v1.0.0-rc1 to be new, got %v", newReleases)
+	}
+
+	// known releases without a fingerprint are only fingerprinted
+	latest := []*Release{testFingerprintRelease("v0.9.0", false, "notes"), testFingerprintRelease("v1.0.0-rc1", true, "notes")}
+	if changed := history.checkForChangedReleases(latest); len(changed) != 0 {
+		t.Fatalf("Expected no changes, got %v", changed)
+	}
+
+	latest = []*Release{testFingerprintRelease("v0.9.0", false, "fixed notes"), testFingerprintRelease("v1.0.0-rc1", false, "notes")}
+	changed := history.checkForChangedReleases(latest)
+	if len(changed) != 2 {
+		t.Fatalf("Expected both releases to have changed, got %v", changed)
+	}
+	if changed[0].event() != EventEdited || changed[0].Variables["RELEASE.CHANGES"] != "body" {
+		t.Errorf("Expected v0.9.0 to be edited, got %s (%v)", changed[0].event(), changed[0].Variables)
+	}
+	if changed[1].event() != EventPromoted || changed[1].Variables["RELEASE.CHANGES"] != "prerelease" {
+		t.Errorf("Expected v1.0.0-rc1 to be promoted, got %s (%v)", changed[1].event(), changed[1].Variables)
+	}
+	if latest[1].Event != "" {
+		t.Errorf("Expected the listed release to be left untouched")
+	}
+
+	if changed := history.checkForChangedReleases(latest); len(changed) != 0 {
+		t.Errorf("Expected changes to be reported once, got %v", changed)
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	if !subscribed(nil, EventPublished) || !subscribed(nil, EventAssetsTimedOut) || subscribed(nil, EventEdited) {
+		t.Errorf("Expected only published and assets_timed_out events by default")
+	}
+	if !subscribed([]string{EventPromoted}, EventPromoted) || subscribed([]string{EventPromoted}, EventPublished) {
+		t.Errorf("Expected only the configured events")
+	}
+}
+
+func TestCheckForRetaggedReleases(t *testing.T) {
+	history := getReleaseHistory(RepositoryEntry{Owner: "fingerprint", Repo: "retags"})
+	release := func(commit string) []*Release {
+		r := testFingerprintRelease("v1.0.0", false, "notes")
+		r.Variables = map[string]string{"RELEASE.COMMIT": commit}
+		return []*Release{r}
+	}
+	history.checkForNewReleases(release("aaaa"))
+
+	if changed := history.checkForChangedReleases(release("bbbb")); len(changed) != 0 {
+		t.Fatalf("Expected a single poll at another commit to be unconfirmed, got %v", changed)
+	}
+	if changed := history.checkForChangedReleases(release("aaaa")); len(changed) != 0 {
+		t.Fatalf("Expected the flaky commit to be forgotten, got %v", changed)
+	}
+	history.checkForChangedReleases(release("bbbb"))
+	changed := history.checkForChangedReleases(release("bbbb"))
+	if len(changed) != 1 || changed[0].event() != EventRetagged {
+		t.Fatalf("Expected v1.0.0 to be retagged, got %v", changed)
+	}
+	if changed[0].Variables["RELEASE.PREVIOUSCOMMIT"] != "aaaa" || changed[0].Variables["RELEASE.COMMIT"] != "bbbb" {
+		t.Errorf("Unexpected commits of the retagged release %v", changed[0].Variables)
+	}
+}
+
+func TestCheckForDeletedReleases(t *testing.T) {
+	history := getReleaseHistory(RepositoryEntry{Owner: "fingerprint", Repo: "deletions"})
+	kept := testFingerprintRelease("v1.0.0", false, "notes")
+	yanked := testFingerprintRelease("v1.0.1", false, "notes")
+	prerelease := testFingerprintRelease("v1.1.0-rc1", true, "notes")
+	history.checkForNewReleases([]*Release{kept, yanked, prerelease})
+
+	if deleted := history.checkForDeletedReleases([]*Release{kept}, false, true); len(deleted) != 0 {
+		t.Fatalf("Expected a single missing listing to be unconfirmed, got %v", deleted)
+	}
+	deleted := history.checkForDeletedReleases([]*Release{kept}, false, true)
+	if len(deleted) != 1 || deleted[0].GetTagName() != "v1.0.1" || deleted[0].event() != EventDeleted {
+		t.Fatalf("Expected only v1.0.1 to be deleted, got %v", deleted)
+	}
+	if !history.known("v1.0.1") {
+		t.Errorf("Expected the deleted release to stay known")
+	}
+	if deleted := history.checkForDeletedReleases([]*Release{kept}, false, true); len(deleted) != 0 {
+		t.Errorf("Expected deletions to be reported once, got %v", deleted)
+	}
+}
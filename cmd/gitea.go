@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+const defaultGiteaTokenEnv = "GITEA_TOKEN"
+
+// page size requested from the gitea api (gitea's default maximum is 50)
+const giteaPageSize = 50
+
+// fetches all releases/prereleases for a gitea or forgejo repo
+//
+// the gitea release api mirrors github's closely enough to decode straight into the github types,
+// drafts are dropped since they are only visible to authorized users and aren't published releases
+func getAllGiteaReleases(repo RepositoryEntry) ([]*github.RepositoryRelease, error) {
+	tokenEnv := repo.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultGiteaTokenEnv
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		log.WithFields(log.Fields{
+			"tokenEnv": tokenEnv,
+		}).Info("No provided gitea token - requests to the gitea api will be unauthenticated")
+	}
+
+	client := &http.Client{}
+	fetched := 0
+
+	var allReleases []*github.RepositoryRelease
+	for page := 1; ; page++ {
+		releasesURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases?limit=%d&page=%d", repo.webURL(), repo.Owner, repo.Repo, giteaPageSize, page)
+		req, err := http.NewRequest("GET", releasesURL, nil)
+		if err != nil {
+			return allReleases, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return allReleases, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return allReleases, fmt.Errorf("gitea api returned %s for %s", resp.Status, releasesURL)
+		}
+		var releases []*github.RepositoryRelease
+		err = json.NewDecoder(resp.Body).Decode(&releases)
+		resp.Body.Close()
+		if err != nil {
+			return allReleases, err
+		}
+		for _, release := range releases {
+			if !release.GetDraft() {
+				allReleases = append(allReleases, release)
+			}
+		}
+		fetched += len(releases)
+		// servers may cap the page size below what was requested so rely on the total count when available
+		total, err := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+		if len(releases) == 0 || (err == nil && fetched >= total) || (err != nil && len(releases) < giteaPageSize) {
+			break
+		}
+	}
+	return allReleases, nil
+}
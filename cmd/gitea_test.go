@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetAllGiteaReleases(t *testing.T) {
+	pages := map[string]string{
+		"1": `[
+			{
+				"tag_name": "v1.2.0",
+				"name": "v1.2.0",
+				"body": "draft notes",
+				"draft": true,
+				"prerelease": false,
+				"published_at": "2023-04-01T00:00:00Z"
+			},
+			{
+				"tag_name": "v1.1.0-rc1",
+				"name": "v1.1.0-rc1",
+				"draft": false,
+				"prerelease": true,
+				"html_url": "https://gitea.example.com/mirror/project/releases/tag/v1.1.0-rc1",
+				"published_at": "2023-03-01T00:00:00Z",
+				"author": {"login": "jdoe", "avatar_url": "https://gitea.example.com/avatars/jdoe", "html_url": "https://gitea.example.com/jdoe"}
+			}
+		]`,
+		"2": `[
+			{
+				"tag_name": "v1.0.0",
+				"name": "v1.0.0",
+				"draft": false,
+				"prerelease": false,
+				"published_at": "2023-01-15T00:00:00Z",
+				"author": {"login": "jdoe"}
+			}
+		]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedPath := "/api/v1/repos/mirror/project/releases"
+		if r.URL.Path != expectedPath {
+			t.Errorf("Expected URL path to be %s, got %s", expectedPath, r.URL.Path)
+		}
+		if token := r.Header.Get("Authorization"); token != "token test_token" {
+			t.Errorf("Expected Authorization header to be 'token test_token', got '%s'", token)
+		}
+		w.Header().Set("X-Total-Count", "3")
+		fmt.Fprint(w, pages[r.URL.Query().Get("page")])
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_GITEA_TOKEN", "test_token")
+	repo := RepositoryEntry{
+		Source:   SourceForgejo,
+		Url:      server.URL,
+		TokenEnv: "TEST_GITEA_TOKEN",
+		Owner:    "mirror",
+		Repo:     "project",
+	}
+
+	releases, err := getAllGiteaReleases(repo)
+	if err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("Expected 2 releases (draft excluded), got %d", len(releases))
+	}
+	for _, release := range releases {
+		if release.GetDraft() {
+			t.Errorf("Draft release %s was not filtered out", release.GetTagName())
+		}
+	}
+
+	latestReleases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get latest releases: %v", err)
+	}
+	if len(latestReleases) != 1 || latestReleases[0].GetTagName() != "v1.0.0" {
+		t.Errorf("Expected only v1.0.0 to be returned as a release")
+	}
+
+	latestPrereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get latest prereleases: %v", err)
+	}
+	if len(latestPrereleases) != 1 || latestPrereleases[0].Author.GetLogin() != "jdoe" {
+		t.Errorf("Expected v1.1.0-rc1 authored by jdoe to be returned as a prerelease")
+	}
+}
@@ -2,16 +2,20 @@ package main
 
 import (
 	"context"
+	"fmt"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"os"
 	"sort"
 
 	"github.com/google/go-github/v55/github"
 )
 
-// sorts releases by publish date (newest to oldest)
-func sortByPublishDate(releases []*github.RepositoryRelease) []*github.RepositoryRelease {
-	sort.Slice(releases, func(i, j int) bool {
+const defaultGithubTokenEnv = "GITHUB_TOKEN"
+
+// sorts releases by publish date (newest to oldest), releases without dates keep their order
+func sortByPublishDate(releases []*Release) []*Release {
+	sort.SliceStable(releases, func(i, j int) bool {
 		if releases[i].PublishedAt == nil && releases[j].PublishedAt == nil {
 			return false // If both are nil, consider them equal
 		} else if releases[i].PublishedAt == nil {
@@ -24,34 +28,170 @@ func sortByPublishDate(releases []*github.RepositoryRelease) []*github.Repositor
 	return releases
 }
 
-// fetches all releases/prereleases for a repo (default gh api pagination is 30 results)
-func getAllReleases(owner string, repo string) ([]*github.RepositoryRelease, error) {
-	token := os.Getenv("GITHUB_TOKEN")
+// fetches all releases/prereleases for a repo from whichever source it is hosted on
+func getAllReleases(repo RepositoryEntry) ([]*Release, error) {
+	if repo.Mode != "" && repo.Mode != ModeReleases && repo.Mode != ModeTags {
+		return nil, fmt.Errorf("unsupported repository mode %q", repo.Mode)
+	}
+	if repo.Mode == ModeTags && repo.source() != SourceGithub {
+		return nil, fmt.Errorf("tag monitoring is not supported for repository source %q", repo.source())
+	}
+	var releases []*github.RepositoryRelease
+	var err error
+	switch repo.source() {
+	case SourceGithub:
+		if repo.Mode == ModeTags {
+			releases, err = getAllGithubTags(repo)
+		} else {
+			releases, err = getAllGithubReleases(repo)
+		}
+	case SourceGitlab:
+		releases, err = getAllGitlabReleases(repo)
+	case SourceGitea, SourceForgejo:
+		releases, err = getAllGiteaReleases(repo)
+	case SourceOCI:
+		return getAllOCIReleases(repo)
+	case SourceHelm:
+		return getAllHelmReleases(repo)
+	case SourceChannels:
+		return getAllChannelReleases(repo)
+	case SourceFeed:
+		return getAllFeedReleases(repo)
+	case SourceGoProxy:
+		return getAllGoProxyReleases(repo)
+	case SourceGit:
+		return getAllGitRemoteReleases(repo)
+	default:
+		return nil, fmt.Errorf("unsupported repository source %q", repo.Source)
+	}
+	return wrapReleases(releases), err
+}
+
+// fills in release details that are too costly to fetch on every poll, only called for newly found releases
+func resolveReleaseDetails(repo RepositoryEntry, release *Release) error {
+	switch repo.source() {
+	case SourceOCI:
+		return resolveOCIReleaseDetails(repo, release)
+	case SourceChannels:
+		return resolveChannelReleaseDetails(repo, release)
+	case SourceGoProxy:
+		return resolveGoProxyReleaseDetails(repo, release)
+	default:
+		return nil
+	}
+}
+
+// creates a github api client for the repo, pointed at its enterprise server when one is configured
+// and revalidating unchanged responses through conditional requests (while keeping track of the rate limit)
+func newGithubClient(repo RepositoryEntry) (*github.Client, error) {
+	token, err := githubToken(repo)
+	if err != nil {
+		return nil, err
+	}
+	return withEnterpriseURLs(github.NewClient(githubHTTPClient(repo, rateLimitKey(repo, token))).WithAuthToken(token), repo)
+}
+
+// returns the http client every github api client is built on, revalidating unchanged responses through conditional
+// requests and keeping track of the rate limit the requests count against in the bucket of the key
+func githubHTTPClient(repo RepositoryEntry, key string) *http.Client {
+	return githubHTTPCache.client(githubRateLimits.transport(repo, key, http.DefaultTransport))
+}
+
+// returns the token to authorize requests for the repo with, empty if requests are unauthenticated
+//
+// a token explicitly referenced by the repo takes precedence over github app authentication, which in turn
+// takes precedence over the default GITHUB_TOKEN
+func githubToken(repo RepositoryEntry) (string, error) {
+	if repo.TokenEnv == "" {
+		app, err := getGithubApp()
+		if err != nil {
+			return "", err
+		}
+		if app != nil {
+			return app.installationToken(repo)
+		}
+	}
+	tokenEnv := repo.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultGithubTokenEnv
+	}
+	token := os.Getenv(tokenEnv)
 	if token == "" {
-		log.Info("No provided github token - requests to the github api will be unathenticated (60 requests/hr rate limit)\n")
+		log.WithFields(log.Fields{
+			"tokenEnv": tokenEnv,
+		}).Info("No provided github token - requests to the github api will be unathenticated (60 requests/hr rate limit)")
+	}
+	return token, nil
+}
+
+// points the client at the repo's enterprise server, if it has one
+func withEnterpriseURLs(client *github.Client, repo RepositoryEntry) (*github.Client, error) {
+	if repo.Url == "" {
+		return client, nil
+	}
+	uploadURL := repo.UploadUrl
+	if uploadURL == "" {
+		uploadURL = repo.Url
+	}
+	return client.WithEnterpriseURLs(repo.Url, uploadURL)
+}
+
+// fetches all releases/prereleases for a github repo (default gh api pagination is 30 results)
+func getAllGithubReleases(repo RepositoryEntry) ([]*github.RepositoryRelease, error) {
+	if githubGraphQL != nil {
+		if releases, ok, err := githubGraphQL.releases(repo); ok {
+			return releases, err
+		}
+	}
+	return listGithubReleases(repo, nil)
+}
+
+// pages through the releases of a github repo (newest first), stopping early once done returns true for a page
+func listGithubReleases(repo RepositoryEntry, done func(page []*github.RepositoryRelease) bool) ([]*github.RepositoryRelease, error) {
+	client, err := newGithubClient(repo)
+	if err != nil {
+		return nil, err
 	}
-	client := github.NewClient(nil).WithAuthToken(token)
 	ctx := context.Background()
 	opt := &github.ListOptions{PerPage: 100}
 
 	var allReleases []*github.RepositoryRelease
 	for {
-		releases, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opt)
+		releases, resp, err := client.Repositories.ListReleases(ctx, repo.Owner, repo.Repo, opt)
 		if err != nil {
 			return releases, err
 		}
 		allReleases = append(allReleases, releases...)
-		if resp.NextPage == 0 {
+		if resp.NextPage == 0 || (done != nil && done(releases)) {
 			break
 		}
 		opt.Page = resp.NextPage
 	}
+
+	// the rest api only tells the branch a release was created from, the tag refs tell what its tag points at.
+	// they are only paged through along with the full listing, incremental polls stay as cheap as their release pages
+	if done != nil {
+		return allReleases, nil
+	}
+	objects, err := getGithubTagObjects(ctx, client, repo)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"repoName": repo.fullName(),
+			"error":    err,
+		}).Warn("Failed to resolve the tags of releases")
+		return allReleases, nil
+	}
+	for _, release := range allReleases {
+		if object, ok := objects[release.GetTagName()]; ok {
+			release.TargetCommitish = github.String(object)
+		}
+	}
 	return allReleases, nil
 }
 
 // filters all prereleases out of the array (leaves only releases)
-func filterPrereleases(releases []*github.RepositoryRelease) []*github.RepositoryRelease {
-	var onlyRegularReleases []*github.RepositoryRelease
+func filterPrereleases(releases []*Release) []*Release {
+	var onlyRegularReleases []*Release
 	for _, release := range releases {
 		if !release.GetPrerelease() {
 			onlyRegularReleases = append(onlyRegularReleases, release)
@@ -61,8 +201,8 @@ func filterPrereleases(releases []*github.RepositoryRelease) []*github.Repositor
 }
 
 // filters all releases out of the array (leaves only prereleases)
-func filterReleases(releases []*github.RepositoryRelease) []*github.RepositoryRelease {
-	var onlyPrereleases []*github.RepositoryRelease
+func filterReleases(releases []*Release) []*Release {
+	var onlyPrereleases []*Release
 	for _, release := range releases {
 		if release.GetPrerelease() {
 			onlyPrereleases = append(onlyPrereleases, release)
@@ -71,15 +211,141 @@ func filterReleases(releases []*github.RepositoryRelease) []*github.RepositoryRe
 	return onlyPrereleases
 }
 
+// filters the releases the repo ignores out of the array, see filterTags and filterVersions
+func filterIgnored(repo RepositoryEntry, releases []*Release) []*Release {
+	return filterVersions(repo, filterTags(repo, releases))
+}
+
+// filters the releases whose tag (or name if enabled) isn't included or is excluded by the repo's patterns
+// out of the array, they are still recorded in the release history by the caller so they are never evaluated again
+func filterTags(repo RepositoryEntry, releases []*Release) []*Release {
+	if len(repo.Include) == 0 && len(repo.Exclude) == 0 {
+		return releases
+	}
+	var included []*Release
+	for _, release := range releases {
+		filter := suppressingFilter(repo, release)
+		if filter == "" {
+			included = append(included, release)
+			continue
+		}
+		log.WithFields(log.Fields{
+			"repoName": repo.fullName(),
+			"release":  release.GetTagName(),
+			"name":     release.GetName(),
+			"filter":   filter,
+		}).Info("Ignoring release suppressed by filter")
+	}
+	return included
+}
+
+// returns the filter of the repo suppressing the release, empty if none does
+func suppressingFilter(repo RepositoryEntry, release *Release) string {
+	values := []string{release.GetTagName()}
+	if repo.FilterNames && release.GetName() != "" {
+		values = append(values, release.GetName())
+	}
+	if len(repo.Include) > 0 && repo.Include.match(values...) == nil {
+		return "include"
+	}
+	if pattern := repo.Exclude.match(values...); pattern != nil {
+		return "exclude " + pattern.String()
+	}
+	return ""
+}
+
+// checks whether the release is within the repo's version range (any release is without one)
+func inVersionRange(repo RepositoryEntry, release *Release) bool {
+	return repo.Versions == nil || repo.Versions.contains(release.version())
+}
+
+// checks whether the repo ignores the release, the silent counterpart of filterIgnored
+func ignored(repo RepositoryEntry, release *Release) bool {
+	return suppressingFilter(repo, release) != "" || !inVersionRange(repo, release)
+}
+
+// filters the releases outside of the repo's version range out of the array, they are still recorded
+// in the release history by the caller so they are never evaluated again
+func filterVersions(repo RepositoryEntry, releases []*Release) []*Release {
+	if repo.Versions == nil {
+		return releases
+	}
+	var inRange []*Release
+	for _, release := range releases {
+		if inVersionRange(repo, release) {
+			inRange = append(inRange, release)
+			continue
+		}
+		log.WithFields(log.Fields{
+			"repoName": repo.fullName(),
+			"release":  release.GetTagName(),
+			"version":  release.version(),
+			"versions": repo.Versions.String(),
+		}).Info("Ignoring release outside of version range")
+	}
+	return inRange
+}
+
 // fetches all releases from repo (sorted by publish date)
 //
 // count specifies the maximum number of releases to return, if its less than 0 there is no max
-func getLatestReleases(owner string, repo string, prerelease bool, count int) ([]*github.RepositoryRelease, error) {
-	var latestReleases []*github.RepositoryRelease
-	latestReleases, err := getAllReleases(owner, repo)
+func getLatestReleases(repo RepositoryEntry, prerelease bool, count int) ([]*Release, error) {
+	latestReleases, err := getAllReleases(repo)
 	if err != nil {
 		return latestReleases, err
 	}
+	return selectLatestReleases(classifyPrereleases(repo, latestReleases), prerelease, count), nil
+}
+
+// fetches the newest releases from repo (sorted by publish date), only paging as far back as the first page
+// in which every release/prerelease (and at least one) is already known
+//
+// only github release listings are ordered newest first, other repos are fetched in full
+func getLatestUnknownReleases(repo RepositoryEntry, prerelease bool, known func(tag string) bool) ([]*Release, error) {
+	if repo.source() != SourceGithub || repo.Mode == ModeTags || githubGraphQL != nil {
+		return getLatestReleases(repo, prerelease, -1)
+	}
+	releases, err := listGithubReleases(repo, func(page []*github.RepositoryRelease) bool {
+		sawKnown := false
+		for _, release := range page {
+			if classifiedPrerelease(repo, &Release{RepositoryRelease: release}) != prerelease {
+				continue
+			}
+			if !known(release.GetTagName()) {
+				return false
+			}
+			sawKnown = true
+		}
+		return sawKnown
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectLatestReleases(classifyPrereleases(repo, wrapReleases(releases)), prerelease, -1), nil
+}
+
+// checks whether the listings of the repo contain all of its releases, so releases missing from them were deleted
+//
+// incremental github listings only cover the newest pages and graphql only the most recent releases, feeds only
+// carry their newest entries and channel releases are replaced whenever a channel moves
+func completeListing(repo RepositoryEntry, fullScan bool) bool {
+	switch repo.source() {
+	case SourceGitlab, SourceGitea, SourceForgejo, SourceOCI, SourceHelm, SourceGoProxy, SourceGit:
+		return true
+	case SourceGithub:
+		if repo.Mode == ModeTags {
+			return true
+		}
+		return fullScan && (githubGraphQL == nil || !graphqlEligible(repo))
+	default:
+		return false
+	}
+}
+
+// filters the releases down to either releases or prereleases and returns the count newest of them
+//
+// count specifies the maximum number of releases to return, if its less than 0 there is no max
+func selectLatestReleases(latestReleases []*Release, prerelease bool, count int) []*Release {
 	if prerelease {
 		latestReleases = filterReleases(latestReleases)
 	} else {
@@ -88,10 +354,10 @@ func getLatestReleases(owner string, repo string, prerelease bool, count int) ([
 	// github api is generally already sorted by date already but they don't officially guarantee such
 	latestReleases = sortByPublishDate(latestReleases)
 	if count == -1 {
-		return latestReleases, nil
+		return latestReleases
 	}
 	if len(latestReleases) > (count - 1) {
 		latestReleases = latestReleases[:count]
 	}
-	return latestReleases, nil
+	return latestReleases
 }
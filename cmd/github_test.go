@@ -1,6 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
@@ -54,13 +59,13 @@ var testRelease5 = &github.RepositoryRelease{
 
 // const testReleaseCount int = 5
 
-var testReleases = []*github.RepositoryRelease{
+var testReleases = wrapReleases([]*github.RepositoryRelease{
 	testRelease1,
 	testRelease2,
 	testRelease3,
 	testRelease4,
 	testRelease5,
-}
+})
 
 func TestSortByPublishedDate(t *testing.T) {
 	expectedTimestamps := []time.Time{
@@ -140,3 +145,237 @@ func TestFilterReleases(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterVersions(t *testing.T) {
+	var repo RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"versions": ">=2.8.0 <2.10.0"}`), &repo); err != nil {
+		t.Fatalf("Failed to parse version range: %v", err)
+	}
+	var releases []*Release
+	for _, tag := range []string{"v2.7.9", "v2.8.0", "2.9.3", "v2.9.0-rc1", "v1.28.2+k3s1", "v2.10.0", "nightly"} {
+		releases = append(releases, &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String(tag)}})
+	}
+	var tags []string
+	for _, release := range filterVersions(repo, releases) {
+		tags = append(tags, release.GetTagName())
+	}
+	if !reflect.DeepEqual(tags, []string{"v2.8.0", "2.9.3", "v2.9.0-rc1"}) {
+		t.Errorf("Unexpected releases within the version range %v", tags)
+	}
+	if len(filterVersions(RepositoryEntry{}, releases)) != len(releases) {
+		t.Errorf("Expected every release to pass without a version range")
+	}
+	if err := json.Unmarshal([]byte(`{"versions": ">=2.8.0 <"}`), &repo); err == nil {
+		t.Errorf("Expected an invalid version range to fail parsing")
+	}
+}
+
+func TestFilterTags(t *testing.T) {
+	var repo RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"include": ["^v1\\.", "^v2\\."], "exclude": ["-alpha", "(?i)hotfix"]}`), &repo); err != nil {
+		t.Fatalf("Failed to parse filters: %v", err)
+	}
+	release := func(tag, name string) *Release {
+		return &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String(tag), Name: github.String(name)}}
+	}
+	releases := []*Release{
+		release("v1.28.0", "Kubernetes v1.28.0"),
+		release("v1.29.0-alpha.1", "Kubernetes v1.29.0-alpha.1"),
+		release("staging/v0.28.0", "Staging"),
+		release("v2.8.1", "Hotfix release"),
+	}
+	var tags []string
+	for _, release := range filterTags(repo, releases) {
+		tags = append(tags, release.GetTagName())
+	}
+	if !reflect.DeepEqual(tags, []string{"v1.28.0", "v2.8.1"}) {
+		t.Errorf("Unexpected releases passing the tag filters %v", tags)
+	}
+
+	repo.FilterNames = true
+	tags = nil
+	for _, release := range filterTags(repo, releases) {
+		tags = append(tags, release.GetTagName())
+	}
+	if !reflect.DeepEqual(tags, []string{"v1.28.0"}) {
+		t.Errorf("Unexpected releases passing the tag and name filters %v", tags)
+	}
+
+	if err := json.Unmarshal([]byte(`{"exclude": ["("]}`), &repo); err == nil {
+		t.Errorf("Expected an invalid pattern to fail parsing")
+	}
+}
+
+func TestGetAllGithubEnterpriseReleases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedURL := "/api/v3/repos/owner/repo/releases"
+		if r.URL.Path == "/api/v3/repos/owner/repo/git/matching-refs/tags" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		if r.URL.Path != expectedURL {
+			t.Errorf("Expected URL path to be %s, got %s", expectedURL, r.URL.Path)
+			return
+		}
+		token := r.Header.Get("Authorization")
+		if token != "Bearer test_token" {
+			t.Errorf("Expected Authorization header to be 'Bearer test_token', got '%s'", token)
+			return
+		}
+		err := json.NewEncoder(w).Encode(testReleases)
+		if err != nil {
+			t.Errorf("Failed to encode response: %s", err)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	t.Setenv("TEST_GHES_TOKEN", "test_token")
+	repo := RepositoryEntry{
+		Url:      ts.URL,
+		TokenEnv: "TEST_GHES_TOKEN",
+		Owner:    "owner",
+		Repo:     "repo",
+	}
+	releases, err := getAllGithubReleases(repo)
+	if err != nil {
+		t.Fatalf("Failed to get releases: %s", err)
+	}
+	if len(releases) != len(testReleases) {
+		t.Errorf("Expected %d releases, got %d", len(testReleases), len(releases))
+	}
+}
+
+func TestGithubReleasesRetagged(t *testing.T) {
+	commit := "1111111111111111111111111111111111111111"
+	annotated := "0000000000000000000000000000000000000000"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/retagged/releases":
+			fmt.Fprint(w, `[{"tag_name": "v1.0.0", "name": "v1.0.0", "target_commitish": "main"}, {"tag_name": "v0.9.0", "name": "v0.9.0", "target_commitish": "main"}]`)
+		case "/api/v3/repos/owner/retagged/git/matching-refs/tags":
+			fmt.Fprintf(w, `[{"ref": "refs/tags/v0.9.0", "object": {"type": "tag", "sha": "%s"}}, {"ref": "refs/tags/v1.0.0", "object": {"type": "commit", "sha": "%s"}}]`, annotated, commit)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	repo := RepositoryEntry{Url: ts.URL, Owner: "owner", Repo: "retagged"}
+	list := func() []*Release {
+		releases, err := getAllGithubReleases(repo)
+		if err != nil {
+			t.Fatalf("Failed to get releases: %s", err)
+		}
+		return wrapReleases(releases)
+	}
+	releases := list()
+	commits := map[string]string{}
+	for _, release := range releases {
+		commits[release.GetTagName()] = releaseCommit(release)
+	}
+	// annotated tags are told apart by their tag object, which isn't peeled
+	if commits["v1.0.0"] != commit || commits["v0.9.0"] != annotated {
+		t.Fatalf("Expected the tag commits to be resolved from the tag refs, got %v", commits)
+	}
+
+	history := getReleaseHistory(repo)
+	history.checkForNewReleases(releases)
+	commit = "2222222222222222222222222222222222222222"
+	annotated = "3333333333333333333333333333333333333333"
+	for i := 1; i < changeConfirmations; i++ {
+		if changed := history.checkForChangedReleases(list()); len(changed) != 0 {
+			t.Fatalf("Expected the retag to be unconfirmed, got %v", changed)
+		}
+		// incremental listings don't resolve the tags and leave the suspected retags alone
+		incremental, err := getLatestUnknownReleases(repo, false, func(tag string) bool { return true })
+		if err != nil {
+			t.Fatalf("Failed to get releases: %s", err)
+		}
+		if len(incremental) != 2 {
+			t.Fatalf("Unexpected releases %v", incremental)
+		}
+		if changed := history.checkForChangedReleases(incremental); len(changed) != 0 {
+			t.Fatalf("Expected the retag to be unconfirmed, got %v", changed)
+		}
+	}
+	changed := history.checkForChangedReleases(list())
+	if len(changed) != 2 || changed[0].event() != EventRetagged || changed[1].event() != EventRetagged {
+		t.Fatalf("Expected v1.0.0 and v0.9.0 to be retagged, got %v", changed)
+	}
+}
+
+func TestGithubRepoURLs(t *testing.T) {
+	tests := []struct {
+		url         string
+		expectedWeb string
+		expectedSSH string
+	}{
+		{"", "https://github.com", "git@github.com:owner/repo"},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com", "git@ghe.example.com:owner/repo"},
+		{"https://ghe.example.com", "https://ghe.example.com", "git@ghe.example.com:owner/repo"},
+		{"https://api.corp.ghe.com/", "https://corp.ghe.com", "git@corp.ghe.com:owner/repo"},
+	}
+	for _, test := range tests {
+		repo := RepositoryEntry{Url: test.url, Owner: "owner", Repo: "repo"}
+		if repo.webURL() != test.expectedWeb {
+			t.Errorf("Expected web url %s for %q, got %s", test.expectedWeb, test.url, repo.webURL())
+		}
+		if repo.sshURL() != test.expectedSSH {
+			t.Errorf("Expected ssh url %s for %q, got %s", test.expectedSSH, test.url, repo.sshURL())
+		}
+	}
+}
+
+func TestGetLatestUnknownReleases(t *testing.T) {
+	pages := map[string]string{
+		"":  `[{"tag_name": "v1.3.0-rc1", "prerelease": true}, {"tag_name": "v1.2.0"}]`,
+		"2": `[{"tag_name": "v1.1.0"}, {"tag_name": "v1.1.0-rc1", "prerelease": true}]`,
+		"3": `[{"tag_name": "v1.0.0"}]`,
+	}
+	// every request is counted, incremental polls shouldn't make any beyond the release pages
+	var requestedPages []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		requestedPages = append(requestedPages, r.URL.Path+"?page="+page)
+		if r.URL.Path != "/api/v3/repos/owner/repo/releases" {
+			return
+		}
+		next := map[string]string{"": "2", "2": "3"}[page]
+		if next != "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=%s>; rel="next"`, "http://"+r.Host, r.URL.Path, next))
+		}
+		fmt.Fprint(w, pages[page])
+	}))
+	defer ts.Close()
+
+	repo := RepositoryEntry{Url: ts.URL, Owner: "owner", Repo: "repo"}
+	known := map[string]bool{"v1.1.0": true, "v1.0.0": true, "v1.1.0-rc1": true}
+	releases, err := getLatestUnknownReleases(repo, false, func(tag string) bool { return known[tag] })
+	if err != nil {
+		t.Fatalf("Failed to get releases: %s", err)
+	}
+	if len(requestedPages) != 2 {
+		t.Errorf("Expected paging to stop after the first page of known releases, requested pages %v", requestedPages)
+	}
+	if len(releases) != 2 || releases[0].GetTagName() != "v1.2.0" {
+		t.Errorf("Unexpected releases %v", releases)
+	}
+
+	requestedPages = nil
+	known = map[string]bool{"v1.3.0-rc1": true}
+	if _, err := getLatestUnknownReleases(repo, true, func(tag string) bool { return known[tag] }); err != nil {
+		t.Fatalf("Failed to get prereleases: %s", err)
+	}
+	if len(requestedPages) != 1 {
+		t.Errorf("Expected paging to stop after the first page of known prereleases, requested pages %v", requestedPages)
+	}
+	requestedPages = nil
+	known = map[string]bool{}
+	if _, err := getLatestUnknownReleases(repo, false, func(tag string) bool { return known[tag] }); err != nil {
+		t.Fatalf("Failed to get releases: %s", err)
+	}
+	if len(requestedPages) != 3 {
+		t.Errorf("Expected all pages to be fetched when no release is known, requested pages %v", requestedPages)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// installation tokens are refreshed once they are closer than this to expiring
+const installationTokenRefreshMargin = 5 * time.Minute
+
+// credentials and cached installation tokens of a github app
+type githubApp struct {
+	sync.Mutex
+	id  int64
+	key *rsa.PrivateKey
+	// fixed installation to use for every repo, 0 if installations are looked up per owner
+	installationID int64
+	installations  map[string]int64
+	tokens         map[int64]*github.InstallationToken
+}
+
+var githubAppOnce sync.Once
+var githubAppAuth *githubApp
+var githubAppErr error
+
+// returns the github app configured through the environment, nil if none is configured
+func getGithubApp() (*githubApp, error) {
+	githubAppOnce.Do(func() {
+		githubAppAuth, githubAppErr = loadGithubApp()
+	})
+	return githubAppAuth, githubAppErr
+}
+
+// sources env vars GITHUB_APP_ID, GITHUB_APP_PRIVATE_KEY_FILE and GITHUB_APP_INSTALLATION_ID
+func loadGithubApp() (*githubApp, error) {
+	appID := os.Getenv("GITHUB_APP_ID")
+	if appID == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(appID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_ID: %v", err)
+	}
+	keyFile := os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE")
+	if keyFile == "" {
+		return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY_FILE must be set when GITHUB_APP_ID is")
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseGithubAppKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	app := &githubApp{
+		id:            id,
+		key:           key,
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]*github.InstallationToken),
+	}
+	if installationID := os.Getenv("GITHUB_APP_INSTALLATION_ID"); installationID != "" {
+		app.installationID, err = strconv.ParseInt(installationID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID: %v", err)
+		}
+	}
+	log.WithFields(log.Fields{
+		"appID":          id,
+		"installationID": app.installationID,
+	}).Info("Authenticating to the github api as a github app")
+	return app, nil
+}
+
+// parses a pem encoded rsa private key (github issues pkcs1 keys but pkcs8 is accepted as well)
+func parseGithubAppKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("github app private key is not pem encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse github app private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("github app private key is not an rsa key")
+	}
+	return key, nil
+}
+
+// mints a short lived jwt identifying the app itself
+func (a *githubApp) jwt() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		// backdated to allow for clock drift, github rejects jwts valid for more than 10 minutes
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.id, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// creates a client authenticated as the app itself (as opposed to one of its installations)
+func (a *githubApp) client(repo RepositoryEntry) (*github.Client, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return nil, err
+	}
+	// the jwt is minted anew for every client, the rate limit of the app is tracked by its id instead
+	key := fmt.Sprintf("%s app %d", githubAPIHost(repo), a.id)
+	return withEnterpriseURLs(github.NewClient(githubHTTPClient(repo, key)).WithAuthToken(jwt), repo)
+}
+
+// returns the installation of the github app whose tokens authenticate requests for the repo, 0 if the repo
+// uses a token of its own or the installation of its owner wasn't looked up yet
+func githubAppInstallation(repo RepositoryEntry) int64 {
+	if repo.TokenEnv != "" {
+		return 0
+	}
+	app, err := getGithubApp()
+	if err != nil || app == nil {
+		return 0
+	}
+	app.Lock()
+	defer app.Unlock()
+	if app.installationID != 0 {
+		return app.installationID
+	}
+	return app.installations[installationKey(repo)]
+}
+
+// the key of the installation covering the repo's owner in the installations of an app
+func installationKey(repo RepositoryEntry) string {
+	return fmt.Sprintf("%s/%s", repo.webURL(), repo.Owner)
+}
+
+// returns the installation of the app covering the repo's owner
+func (a *githubApp) installation(repo RepositoryEntry) (int64, error) {
+	if a.installationID != 0 {
+		return a.installationID, nil
+	}
+	key := installationKey(repo)
+	if id, ok := a.installations[key]; ok {
+		return id, nil
+	}
+	client, err := a.client(repo)
+	if err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	installation, resp, err := client.Apps.FindOrganizationInstallation(ctx, repo.Owner)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		installation, _, err = client.Apps.FindUserInstallation(ctx, repo.Owner)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find github app installation for %s: %v", repo.Owner, err)
+	}
+	a.installations[key] = installation.GetID()
+	log.WithFields(log.Fields{
+		"owner":          repo.Owner,
+		"installationID": installation.GetID(),
+	}).Info("Found github app installation")
+	return installation.GetID(), nil
+}
+
+// returns a valid installation token for the repo's owner, minting a new one if the cached one is about to expire
+func (a *githubApp) installationToken(repo RepositoryEntry) (string, error) {
+	a.Lock()
+	defer a.Unlock()
+	id, err := a.installation(repo)
+	if err != nil {
+		return "", err
+	}
+	if token, ok := a.tokens[id]; ok && time.Until(token.GetExpiresAt().Time) > installationTokenRefreshMargin {
+		return token.GetToken(), nil
+	}
+	client, err := a.client(repo)
+	if err != nil {
+		return "", err
+	}
+	token, _, err := client.Apps.CreateInstallationToken(context.Background(), id, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create github app installation token: %v", err)
+	}
+	a.tokens[id] = token
+	log.WithFields(log.Fields{
+		"installationID": id,
+		"expiresAt":      token.GetExpiresAt().String(),
+	}).Debug("Minted github app installation token")
+	return token.GetToken(), nil
+}
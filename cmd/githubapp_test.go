@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestAppKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	t.Setenv("GITHUB_APP_ID", "1234")
+	t.Setenv("GITHUB_APP_PRIVATE_KEY_FILE", keyFile)
+	return key
+}
+
+func TestGithubAppJWT(t *testing.T) {
+	key := writeTestAppKey(t)
+	app, err := loadGithubApp()
+	if err != nil {
+		t.Fatalf("Failed to load github app: %v", err)
+	}
+	jwt, err := app.jwt()
+	if err != nil {
+		t.Fatalf("Failed to mint jwt: %v", err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected jwt to have 3 parts, got %d", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode jwt signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Invalid jwt signature: %v", err)
+	}
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("Failed to decode jwt claims: %v", err)
+	}
+	if claims["iss"] != "1234" {
+		t.Errorf("Expected issuer 1234, got %v", claims["iss"])
+	}
+}
+
+func TestGithubAppInstallationToken(t *testing.T) {
+	writeTestAppKey(t)
+	tokenRequests := 0
+	expiresAt := time.Now().Add(time.Hour)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ey") {
+			t.Errorf("Expected app requests to be authenticated with a jwt, got %s", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/api/v3/orgs/rancher/installation":
+			fmt.Fprint(w, `{"id": 42}`)
+		case "/api/v3/orgs/clanktron/installation":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		case "/api/v3/users/clanktron/installation":
+			fmt.Fprint(w, `{"id": 43}`)
+		case "/api/v3/app/installations/42/access_tokens", "/api/v3/app/installations/43/access_tokens":
+			if r.Method != http.MethodPost {
+				t.Errorf("Expected POST request, got %s", r.Method)
+			}
+			tokenRequests++
+			fmt.Fprintf(w, `{"token": "ghs_%d", "expires_at": "%s"}`, tokenRequests, expiresAt.Format(time.RFC3339))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	app, err := loadGithubApp()
+	if err != nil {
+		t.Fatalf("Failed to load github app: %v", err)
+	}
+	repo := RepositoryEntry{Url: ts.URL, Owner: "rancher", Repo: "rancher"}
+	token, err := app.installationToken(repo)
+	if err != nil {
+		t.Fatalf("Failed to get installation token: %v", err)
+	}
+	if token != "ghs_1" {
+		t.Errorf("Expected token ghs_1, got %s", token)
+	}
+	token, _ = app.installationToken(repo)
+	if token != "ghs_1" || tokenRequests != 1 {
+		t.Errorf("Expected cached token to be reused, got %s after %d requests", token, tokenRequests)
+	}
+
+	userRepo := RepositoryEntry{Url: ts.URL, Owner: "clanktron", Repo: "dummy"}
+	token, err = app.installationToken(userRepo)
+	if err != nil {
+		t.Fatalf("Failed to get user installation token: %v", err)
+	}
+	if token != "ghs_2" {
+		t.Errorf("Expected a token of the user installation, got %s", token)
+	}
+
+	// tokens about to expire are refreshed
+	expiresAt = time.Now().Add(time.Minute)
+	app.tokens[42].ExpiresAt.Time = expiresAt
+	token, _ = app.installationToken(repo)
+	if token != "ghs_3" {
+		t.Errorf("Expected expiring token to be refreshed, got %s", token)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+const defaultGitlabTokenEnv = "GITLAB_TOKEN"
+
+type gitlabRelease struct {
+	TagName         string     `json:"tag_name"`
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	CreatedAt       *time.Time `json:"created_at"`
+	ReleasedAt      *time.Time `json:"released_at"`
+	UpcomingRelease bool       `json:"upcoming_release"`
+	Author          struct {
+		Username  string `json:"username"`
+		AvatarURL string `json:"avatar_url"`
+		WebURL    string `json:"web_url"`
+	} `json:"author"`
+	Links struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+	Assets struct {
+		Links []struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+// converts a gitlab release into the github representation used throughout releasebot
+//
+// gitlab has no notion of prereleases, upcoming releases (release date in the future) are treated as such instead
+func (r gitlabRelease) toGithubRelease() *github.RepositoryRelease {
+	release := &github.RepositoryRelease{
+		TagName:    github.String(r.TagName),
+		Name:       github.String(r.Name),
+		Body:       github.String(r.Description),
+		Draft:      github.Bool(false),
+		Prerelease: github.Bool(r.UpcomingRelease),
+		HTMLURL:    github.String(r.Links.Self),
+		Author: &github.User{
+			Login:     github.String(r.Author.Username),
+			AvatarURL: github.String(r.Author.AvatarURL),
+			HTMLURL:   github.String(r.Author.WebURL),
+		},
+	}
+	if r.CreatedAt != nil {
+		release.CreatedAt = &github.Timestamp{Time: *r.CreatedAt}
+	}
+	if r.ReleasedAt != nil {
+		release.PublishedAt = &github.Timestamp{Time: *r.ReleasedAt}
+	}
+	for _, link := range r.Assets.Links {
+		release.Assets = append(release.Assets, &github.ReleaseAsset{
+			Name:               github.String(link.Name),
+			BrowserDownloadURL: github.String(link.URL),
+		})
+	}
+	return release
+}
+
+// fetches all releases/upcoming releases for a gitlab project (api pagination is followed via the X-Next-Page header)
+func getAllGitlabReleases(repo RepositoryEntry) ([]*github.RepositoryRelease, error) {
+	tokenEnv := repo.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultGitlabTokenEnv
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		log.WithFields(log.Fields{
+			"tokenEnv": tokenEnv,
+		}).Info("No provided gitlab token - requests to the gitlab api will be unauthenticated")
+	}
+
+	projectID := url.PathEscape(fmt.Sprintf("%s/%s", repo.Owner, repo.Repo))
+	client := &http.Client{}
+	page := "1"
+
+	var allReleases []*github.RepositoryRelease
+	for page != "" {
+		releasesURL := fmt.Sprintf("%s/api/v4/projects/%s/releases?per_page=100&page=%s", repo.webURL(), projectID, page)
+		req, err := http.NewRequest("GET", releasesURL, nil)
+		if err != nil {
+			return allReleases, err
+		}
+		if token != "" {
+			req.Header.Set("PRIVATE-TOKEN", token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return allReleases, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return allReleases, fmt.Errorf("gitlab api returned %s for %s", resp.Status, releasesURL)
+		}
+		var releases []gitlabRelease
+		err = json.NewDecoder(resp.Body).Decode(&releases)
+		resp.Body.Close()
+		if err != nil {
+			return allReleases, err
+		}
+		for _, release := range releases {
+			allReleases = append(allReleases, release.toGithubRelease())
+		}
+		page = resp.Header.Get("X-Next-Page")
+		if _, err := strconv.Atoi(page); err != nil {
+			page = ""
+		}
+	}
+	return allReleases, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetAllGitlabReleases(t *testing.T) {
+	pages := map[string]string{
+		"1": `[
+			{
+				"tag_name": "v1.1.0-rc1",
+				"name": "v1.1.0-rc1",
+				"description": "upcoming",
+				"released_at": "2023-03-01T00:00:00Z",
+				"upcoming_release": true,
+				"author": {"username": "jdoe", "avatar_url": "https://gitlab.example.com/avatar.png", "web_url": "https://gitlab.example.com/jdoe"},
+				"_links": {"self": "https://gitlab.example.com/group/sub/project/-/releases/v1.1.0-rc1"}
+			}
+		]`,
+		"2": `[
+			{
+				"tag_name": "v1.0.0",
+				"name": "v1.0.0",
+				"description": "first release",
+				"released_at": "2023-01-15T00:00:00Z",
+				"upcoming_release": false,
+				"author": {"username": "jdoe"},
+				"_links": {"self": "https://gitlab.example.com/group/sub/project/-/releases/v1.0.0"},
+				"assets": {"links": [{"name": "project.tgz", "url": "https://gitlab.example.com/project.tgz"}]}
+			}
+		]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedPath := "/api/v4/projects/group%2Fsub%2Fproject/releases"
+		if r.URL.EscapedPath() != expectedPath {
+			t.Errorf("Expected URL path to be %s, got %s", expectedPath, r.URL.EscapedPath())
+		}
+		if token := r.Header.Get("PRIVATE-TOKEN"); token != "test_token" {
+			t.Errorf("Expected PRIVATE-TOKEN header to be 'test_token', got '%s'", token)
+		}
+		page := r.URL.Query().Get("page")
+		if page == "1" {
+			w.Header().Set("X-Next-Page", "2")
+		}
+		fmt.Fprint(w, pages[page])
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_GITLAB_TOKEN", "test_token")
+	repo := RepositoryEntry{
+		Source:   SourceGitlab,
+		Url:      server.URL,
+		TokenEnv: "TEST_GITLAB_TOKEN",
+		Owner:    "group/sub",
+		Repo:     "project",
+	}
+
+	releases, err := getAllGitlabReleases(repo)
+	if err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("Expected 2 releases, got %d", len(releases))
+	}
+	if !releases[0].GetPrerelease() {
+		t.Errorf("Expected upcoming release %s to be a prerelease", releases[0].GetTagName())
+	}
+	if releases[1].GetPrerelease() {
+		t.Errorf("Expected release %s not to be a prerelease", releases[1].GetTagName())
+	}
+	if releases[1].GetHTMLURL() != "https://gitlab.example.com/group/sub/project/-/releases/v1.0.0" {
+		t.Errorf("Unexpected html url %s", releases[1].GetHTMLURL())
+	}
+	if len(releases[1].Assets) != 1 || releases[1].Assets[0].GetName() != "project.tgz" {
+		t.Errorf("Expected release %s to have asset project.tgz", releases[1].GetTagName())
+	}
+
+	onlyPrereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get latest prereleases: %v", err)
+	}
+	if len(onlyPrereleases) != 1 || onlyPrereleases[0].GetTagName() != "v1.1.0-rc1" {
+		t.Errorf("Expected only v1.1.0-rc1 to be returned as a prerelease")
+	}
+}
+
+func TestGitlabRepoURLs(t *testing.T) {
+	repo := RepositoryEntry{
+		Source: SourceGitlab,
+		Owner:  "group/sub",
+		Repo:   "project",
+	}
+	if repo.webURL() != "https://gitlab.com" {
+		t.Errorf("Expected default gitlab url, got %s", repo.webURL())
+	}
+	repo.Url = "https://gitlab.example.com/"
+	if repo.sshURL() != "git@gitlab.example.com:group/sub/project" {
+		t.Errorf("Unexpected ssh url %s", repo.sshURL())
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/google/go-github/v55/github"
+)
+
+const defaultGitCredentialsEnv = "GIT_CREDENTIALS"
+
+// a tag of a git remote along with the objects it points at
+type gitRemoteTag struct {
+	Name string
+	// the commit the tag points at (peeled for annotated tags)
+	Commit string
+	// the tag object of an annotated tag, empty for lightweight tags
+	Object string
+}
+
+// lists the tags of a git remote, the equivalent of git ls-remote --tags
+//
+// https remotes are authenticated with `username:password` credentials (a token works as password),
+// ssh remotes use the ssh agent and known_hosts like git does and file:// remotes are local (bare) repositories
+func listGitRemoteTags(repo RepositoryEntry) ([]gitRemoteTag, error) {
+	if path, ok := strings.CutPrefix(repo.Url, "file://"); ok {
+		return listLocalGitTags(path)
+	}
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repo.Url},
+	})
+	opts := &git.ListOptions{PeelingOption: git.AppendPeeled}
+	credentialsEnv := repo.TokenEnv
+	if credentialsEnv == "" {
+		credentialsEnv = defaultGitCredentialsEnv
+	}
+	if credentials := os.Getenv(credentialsEnv); credentials != "" && strings.HasPrefix(repo.Url, "http") {
+		username, password, _ := strings.Cut(credentials, ":")
+		opts.Auth = &githttp.BasicAuth{Username: username, Password: password}
+	}
+	refs, err := remote.List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %v", repo.Url, err)
+	}
+
+	tags := make(map[string]*gitRemoteTag)
+	peeled := make(map[string]string)
+	for _, ref := range refs {
+		name := ref.Name().String()
+		if !strings.HasPrefix(name, "refs/tags/") || ref.Type() != plumbing.HashReference {
+			continue
+		}
+		name = strings.TrimPrefix(name, "refs/tags/")
+		if tag, ok := strings.CutSuffix(name, "^{}"); ok {
+			peeled[tag] = ref.Hash().String()
+			continue
+		}
+		tags[name] = &gitRemoteTag{Name: name, Commit: ref.Hash().String()}
+	}
+	var list []gitRemoteTag
+	for name, tag := range tags {
+		if commit, ok := peeled[name]; ok {
+			tag.Object = tag.Commit
+			tag.Commit = commit
+		}
+		list = append(list, *tag)
+	}
+	return sortGitTags(list), nil
+}
+
+// lists the tags of a local repository (go-git shells out to git-upload-pack for file:// remotes, so it is read directly)
+func listLocalGitTags(path string) ([]gitRemoteTag, error) {
+	local, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository %s: %v", path, err)
+	}
+	refs, err := local.Tags()
+	if err != nil {
+		return nil, err
+	}
+	var list []gitRemoteTag
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		tag := gitRemoteTag{Name: ref.Name().Short(), Commit: ref.Hash().String()}
+		if annotated, err := local.TagObject(ref.Hash()); err == nil {
+			commit, err := annotated.Commit()
+			if err != nil {
+				return err
+			}
+			tag.Object = tag.Commit
+			tag.Commit = commit.Hash.String()
+		}
+		list = append(list, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortGitTags(list), nil
+}
+
+func sortGitTags(tags []gitRemoteTag) []gitRemoteTag {
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags
+}
+
+func gitTagToRelease(repo RepositoryEntry, tag gitRemoteTag) *Release {
+	return &Release{
+		RepositoryRelease: &github.RepositoryRelease{
+			TagName:         github.String(tag.Name),
+			Name:            github.String(tag.Name),
+			TargetCommitish: github.String(tag.Commit),
+			Draft:           github.Bool(false),
+			Prerelease:      github.Bool(isPrereleaseTag(tag.Name)),
+		},
+		Variables: map[string]string{
+			"REPO.URL":          repo.Url,
+			"RELEASE.COMMIT":    tag.Commit,
+			"RELEASE.TAGOBJECT": tag.Object,
+		},
+	}
+}
+
+// fetches every tag of a plain git remote as a release
+//
+// the commit a tag points at is fingerprinted like any release's, so a moved tag is reported as retagged
+func getAllGitRemoteReleases(repo RepositoryEntry) ([]*Release, error) {
+	if repo.Url == "" {
+		return nil, fmt.Errorf("url of the git remote is required for repository source %q", SourceGit)
+	}
+	tags, err := listGitRemoteTags(repo)
+	if err != nil {
+		return nil, err
+	}
+	var releases []*Release
+	for _, tag := range tags {
+		releases = append(releases, gitTagToRelease(repo, tag))
+	}
+	return releases, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestGetAllGitRemoteReleases(t *testing.T) {
+	dir := t.TempDir()
+	local, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	worktree, err := local.Worktree()
+	if err != nil {
+		t.Fatalf("Failed to open worktree: %v", err)
+	}
+	signature := &object.Signature{Name: "releasebot", Email: "releasebot@example.com", When: time.Now()}
+	commit := func(content string) plumbing.Hash {
+		if err := os.WriteFile(filepath.Join(dir, "VERSION"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if _, err := worktree.Add("VERSION"); err != nil {
+			t.Fatalf("Failed to stage file: %v", err)
+		}
+		hash, err := worktree.Commit(content, &git.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		return hash
+	}
+	first := commit("v1.0.0")
+	if _, err := local.CreateTag("v1.0.0", first, nil); err != nil {
+		t.Fatalf("Failed to create lightweight tag: %v", err)
+	}
+	second := commit("v1.1.0-rc1")
+	annotated, err := local.CreateTag("v1.1.0-rc1", second, &git.CreateTagOptions{Tagger: signature, Message: "v1.1.0-rc1"})
+	if err != nil {
+		t.Fatalf("Failed to create annotated tag: %v", err)
+	}
+
+	repo := RepositoryEntry{Source: SourceGit, Url: "file://" + dir, Repo: "dummy"}
+	releases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get git remote releases: %v", err)
+	}
+	if len(releases) != 1 || releases[0].GetTagName() != "v1.0.0" {
+		t.Fatalf("Expected only v1.0.0 to be a release, got %v", releases)
+	}
+	if releases[0].Variables["RELEASE.COMMIT"] != first.String() || releases[0].Variables["RELEASE.TAGOBJECT"] != "" {
+		t.Errorf("Unexpected commit variables of a lightweight tag %v", releases[0].Variables)
+	}
+
+	prereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get git remote prereleases: %v", err)
+	}
+	if len(prereleases) != 1 || prereleases[0].GetTagName() != "v1.1.0-rc1" {
+		t.Fatalf("Expected v1.1.0-rc1 to be a prerelease, got %v", prereleases)
+	}
+	if prereleases[0].GetTargetCommitish() != second.String() || prereleases[0].Variables["RELEASE.TAGOBJECT"] != annotated.Hash().String() {
+		t.Errorf("Expected annotated tag to be peeled to its commit, got %v", prereleases[0].Variables)
+	}
+
+	// moving a tag is reported as a retag once confirmed
+	history := getReleaseHistory(repo)
+	history.checkForNewReleases(releases)
+	if err := local.DeleteTag("v1.0.0"); err != nil {
+		t.Fatalf("Failed to delete tag: %v", err)
+	}
+	if _, err := local.CreateTag("v1.0.0", second, nil); err != nil {
+		t.Fatalf("Failed to move tag: %v", err)
+	}
+	var changed []*Release
+	for i := 0; i < changeConfirmations; i++ {
+		releases, err = getLatestReleases(repo, false, -1)
+		if err != nil {
+			t.Fatalf("Failed to get git remote releases: %v", err)
+		}
+		changed = history.checkForChangedReleases(releases)
+	}
+	if len(changed) != 1 || changed[0].event() != EventRetagged || changed[0].Variables["RELEASE.PREVIOUSCOMMIT"] != first.String() {
+		t.Errorf("Expected v1.0.0 to be retagged, got %v", changed)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const defaultGoProxyCredentialsEnv = "GOPROXY_CREDENTIALS"
+
+// the metadata of a module version served by the proxy at /@v/<version>.info
+type goModuleInfo struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+	Origin  *struct {
+		VCS  string `json:"VCS"`
+		URL  string `json:"URL"`
+		Ref  string `json:"Ref"`
+		Hash string `json:"Hash"`
+	} `json:"Origin"`
+}
+
+// the module path of a repo, owner holds everything up to the last path element (e.g. golang.org/x and net)
+func goModulePath(repo RepositoryEntry) string {
+	return repo.fullName()
+}
+
+// fetches a file of the module from the proxy, file:// urls (a local GOPROXY directory) are read from disk
+func getGoProxyFile(repo RepositoryEntry, file string) (*http.Response, error) {
+	escaped, err := module.EscapePath(goModulePath(repo))
+	if err != nil {
+		return nil, err
+	}
+	filePath := fmt.Sprintf("%s/@v/%s", escaped, file)
+	fileURL := repo.webURL() + "/" + filePath
+	client := &http.Client{}
+	requestURL := fileURL
+	if dir, ok := strings.CutPrefix(repo.webURL(), "file://"); ok {
+		// only a local GOPROXY directory is read from disk and nothing outside of it, remote proxies can't redirect to files
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.RegisterProtocol("file", http.NewFileTransport(http.Dir(dir)))
+		client.Transport = transport
+		requestURL = "file:///" + filePath
+	}
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	credentialsEnv := repo.TokenEnv
+	if credentialsEnv == "" {
+		credentialsEnv = defaultGoProxyCredentialsEnv
+	}
+	if credentials := os.Getenv(credentialsEnv); credentials != "" {
+		username, password, _ := strings.Cut(credentials, ":")
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("module proxy returned %s for %s", resp.Status, fileURL)
+	}
+	return resp, nil
+}
+
+// converts a module version into a release, versions with a semver prerelease are treated as prereleases
+func goModuleToRelease(repo RepositoryEntry, version string) *Release {
+	path := goModulePath(repo)
+	return &Release{
+		RepositoryRelease: &github.RepositoryRelease{
+			TagName:    github.String(version),
+			Name:       github.String(fmt.Sprintf("%s@%s", path, version)),
+			Draft:      github.Bool(false),
+			Prerelease: github.Bool(semver.Prerelease(version) != ""),
+			HTMLURL:    github.String(fmt.Sprintf("https://pkg.go.dev/%s@%s", path, version)),
+		},
+		Variables: map[string]string{
+			"REPO.URL":       path,
+			"MODULE.PATH":    path,
+			"MODULE.VERSION": version,
+		},
+	}
+}
+
+// fetches every version the proxy lists for the module as releases (sorted newest first by semver, as the list
+// carries no dates), pseudo-versions are ignored
+func getAllGoProxyReleases(repo RepositoryEntry) ([]*Release, error) {
+	resp, err := getGoProxyFile(repo, "list")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var versions []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		version := strings.TrimSpace(scanner.Text())
+		if !semver.IsValid(version) || module.IsPseudoVersion(version) {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) > 0
+	})
+	var releases []*Release
+	for _, version := range versions {
+		releases = append(releases, goModuleToRelease(repo, version))
+	}
+	return releases, nil
+}
+
+// fetches the publish time and origin of a module version
+func resolveGoProxyReleaseDetails(repo RepositoryEntry, release *Release) error {
+	version, err := module.EscapeVersion(release.GetTagName())
+	if err != nil {
+		return err
+	}
+	resp, err := getGoProxyFile(repo, version+".info")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var info goModuleInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return err
+	}
+	if release.Variables == nil {
+		release.Variables = make(map[string]string)
+	}
+	if !info.Time.IsZero() {
+		release.CreatedAt = &github.Timestamp{Time: info.Time}
+		release.PublishedAt = release.CreatedAt
+		release.Variables["MODULE.TIME"] = release.CreatedAt.String()
+	}
+	if info.Origin != nil {
+		release.Variables["MODULE.ORIGIN"] = info.Origin.URL
+		release.TargetCommitish = github.String(info.Origin.Hash)
+	}
+	return nil
+}
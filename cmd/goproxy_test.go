@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestGoProxy(t *testing.T) string {
+	dir := t.TempDir()
+	versionDir := filepath.Join(dir, "github.com", "!example", "lib", "@v")
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		t.Fatalf("Failed to create proxy directory: %v", err)
+	}
+	files := map[string]string{
+		"list":             "v1.0.0\nv1.2.0-rc.1\nv1.1.0\nv0.0.0-20230901120000-abcdef123456\nv1.1.1-0.20230902120000-abcdef123456\n",
+		"v1.1.0.info":      `{"Version": "v1.1.0", "Time": "2023-09-01T12:00:00Z", "Origin": {"VCS": "git", "URL": "https://github.com/Example/lib", "Ref": "refs/tags/v1.1.0", "Hash": "0123456789abcdef"}}`,
+		"v1.2.0-rc.1.info": `{"Version": "v1.2.0-rc.1", "Time": "2023-09-10T12:00:00Z"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(versionDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write proxy file: %v", err)
+		}
+	}
+	return "file://" + dir
+}
+
+func TestGetAllGoProxyReleases(t *testing.T) {
+	repo := RepositoryEntry{Source: SourceGoProxy, Url: writeTestGoProxy(t), Owner: "github.com/Example", Repo: "lib"}
+
+	releases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get module releases: %v", err)
+	}
+	if len(releases) != 2 || releases[0].GetTagName() != "v1.1.0" || releases[1].GetTagName() != "v1.0.0" {
+		t.Fatalf("Expected v1.1.0 and v1.0.0 without pseudo-versions, got %v", releases)
+	}
+	if releases[0].Variables["MODULE.PATH"] != "github.com/Example/lib" || releases[0].GetHTMLURL() != "https://pkg.go.dev/github.com/Example/lib@v1.1.0" {
+		t.Errorf("Unexpected module release %v", releases[0].Variables)
+	}
+
+	prereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get module prereleases: %v", err)
+	}
+	if len(prereleases) != 1 || prereleases[0].GetTagName() != "v1.2.0-rc.1" {
+		t.Errorf("Expected v1.2.0-rc.1 to be classified as a prerelease, got %v", prereleases)
+	}
+
+	release := releases[0]
+	if err := resolveReleaseDetails(repo, release); err != nil {
+		t.Fatalf("Failed to resolve module release details: %v", err)
+	}
+	if !release.GetPublishedAt().Time.Equal(time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected publish time %v", release.GetPublishedAt())
+	}
+	if release.Variables["MODULE.ORIGIN"] != "https://github.com/Example/lib" || release.GetTargetCommitish() != "0123456789abcdef" {
+		t.Errorf("Unexpected module origin %s at %s", release.Variables["MODULE.ORIGIN"], release.GetTargetCommitish())
+	}
+
+	if err := resolveReleaseDetails(repo, releases[1]); err == nil {
+		t.Errorf("Expected a missing info file to fail resolving release details")
+	}
+}
+
+func TestGoProxyRemoteRequests(t *testing.T) {
+	local := writeTestGoProxy(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/github.com/!example/lib/@v/list":
+			// a remote proxy must not be able to make releasebot read local files
+			http.Redirect(w, r, local+"/github.com/!example/lib/@v/list", http.StatusFound)
+		case "/github.com/!example/lib/@v/v1.0.0-!r!c1.info":
+			fmt.Fprint(w, `{"Version": "v1.0.0-RC1", "Time": "2023-09-01T12:00:00Z"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	repo := RepositoryEntry{Source: SourceGoProxy, Url: ts.URL, Owner: "github.com/Example", Repo: "lib"}
+	if _, err := getAllGoProxyReleases(repo); err == nil {
+		t.Errorf("Expected a redirect to a local file to fail")
+	}
+	release := goModuleToRelease(repo, "v1.0.0-RC1")
+	if err := resolveReleaseDetails(repo, release); err != nil {
+		t.Fatalf("Expected the version to be escaped in the info request: %v", err)
+	}
+	if release.Variables["MODULE.TIME"] == "" {
+		t.Errorf("Expected the publish time to be resolved")
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// number of repos queried per graphql request, keeps each request well within github's node limits
+const graphqlReposPerQuery = 25
+
+// number of most recent releases fetched per repo, releases beyond these are never seen by graphql polling
+const graphqlReleasesPerRepo = 50
+
+var useGraphQL, _ = strconv.ParseBool(os.Getenv("GITHUB_GRAPHQL"))
+
+// the batcher serving github releases when GITHUB_GRAPHQL is enabled, nil otherwise
+var githubGraphQL *graphqlBatcher
+
+// fetches the releases of all registered github repos sharing an endpoint and token in batched graphql queries
+//
+// the first monitor to poll after a batch went stale refreshes it for every repo of the batch,
+// the others are served from the batch until it goes stale again
+type graphqlBatcher struct {
+	sync.Mutex
+	maxAge  time.Duration
+	repos   map[string]RepositoryEntry
+	batches map[string]*graphqlBatch
+}
+
+// the last fetched releases of the repos sharing an endpoint and token
+type graphqlBatch struct {
+	sync.Mutex
+	fetchedAt time.Time
+	releases  map[string][]*github.RepositoryRelease
+	errors    map[string]error
+}
+
+func newGraphQLBatcher(maxAge time.Duration) *graphqlBatcher {
+	return &graphqlBatcher{
+		maxAge:  maxAge,
+		repos:   make(map[string]RepositoryEntry),
+		batches: make(map[string]*graphqlBatch),
+	}
+}
+
+// only github repos monitoring releases can be fetched through graphql
+func graphqlEligible(repo RepositoryEntry) bool {
+	return repo.source() == SourceGithub && repo.Mode != ModeTags && repo.Owner != "" && repo.Repo != ""
+}
+
+// the graphql endpoint of the repo's github instance, next to the rest api for api.<host> style urls
+// and at /api/graphql for enterprise servers (whose rest api is at /api/v3)
+func graphqlURL(repo RepositoryEntry) string {
+	if repo.Url == "" {
+		return "https://api.github.com/graphql"
+	}
+	base := strings.TrimSuffix(repo.Url, "/")
+	if parsed, err := url.Parse(base); err == nil && strings.HasPrefix(parsed.Host, "api.") {
+		return base + "/graphql"
+	}
+	return strings.TrimSuffix(base, "/api/v3") + "/api/graphql"
+}
+
+func graphqlRepoKey(repo RepositoryEntry) string {
+	return strings.ToLower(fmt.Sprintf("%s %s/%s", graphqlURL(repo), repo.Owner, repo.Repo))
+}
+
+// adds the repo to the batches, so it is fetched along with the others before it polls itself
+func (b *graphqlBatcher) register(repo RepositoryEntry) {
+	if !graphqlEligible(repo) {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.repos[graphqlRepoKey(repo)] = repo
+}
+
+// removes the repo from the batches once it is no longer monitored
+//
+// other monitors of the repo register it again on their next poll, before their batch is refreshed
+func (b *graphqlBatcher) unregister(repo RepositoryEntry) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.repos, graphqlRepoKey(repo))
+}
+
+// returns the releases of the repo from its batch, refreshing the batch if it is stale or doesn't cover the repo yet
+//
+// ok is false if the repo can't be fetched through graphql (graphql requires authentication) and has to be fetched otherwise
+func (b *graphqlBatcher) releases(repo RepositoryEntry) (releases []*github.RepositoryRelease, ok bool, err error) {
+	if !graphqlEligible(repo) {
+		return nil, false, nil
+	}
+	token, err := githubToken(repo)
+	if err != nil {
+		return nil, true, err
+	}
+	if token == "" {
+		return nil, false, nil
+	}
+	b.register(repo)
+	key := graphqlRepoKey(repo)
+	batch := b.batch(repo, token)
+
+	batch.Lock()
+	defer batch.Unlock()
+	_, covered := batch.releases[key]
+	if _, failed := batch.errors[key]; failed {
+		covered = true
+	}
+	if !covered || time.Since(batch.fetchedAt) > b.maxAge {
+		batch.releases, batch.errors = fetchGraphQLReleases(repo, token, b.members(repo, token))
+		batch.fetchedAt = time.Now()
+	}
+	if err, failed := batch.errors[key]; failed {
+		return nil, true, err
+	}
+	return batch.releases[key], true, nil
+}
+
+// returns the batch of repos sharing the repo's endpoint and token
+func (b *graphqlBatcher) batch(repo RepositoryEntry, token string) *graphqlBatch {
+	b.Lock()
+	defer b.Unlock()
+	batchKey := graphqlURL(repo) + "\x00" + token
+	batch, ok := b.batches[batchKey]
+	if !ok {
+		batch = &graphqlBatch{}
+		b.batches[batchKey] = batch
+	}
+	return batch
+}
+
+// returns the registered repos sharing the repo's endpoint and token, only called when a batch is refreshed
+//
+// the token is resolved once for every token env and owner (the github app installation) rather than for every repo
+func (b *graphqlBatcher) members(repo RepositoryEntry, token string) []RepositoryEntry {
+	b.Lock()
+	defer b.Unlock()
+	tokens := make(map[string]string)
+	var members []RepositoryEntry
+	for _, member := range b.repos {
+		// repos using another token (e.g. another github app installation) are batched separately
+		if graphqlURL(member) != graphqlURL(repo) {
+			continue
+		}
+		credentials := member.TokenEnv + "\x00" + strings.ToLower(member.Owner)
+		memberToken, ok := tokens[credentials]
+		if !ok {
+			resolved, err := githubToken(member)
+			if err != nil {
+				continue
+			}
+			tokens[credentials], memberToken = resolved, resolved
+		}
+		if memberToken != token {
+			continue
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+type graphqlRelease struct {
+	DatabaseID   int64      `json:"databaseId"`
+	TagName      string     `json:"tagName"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	Description  string     `json:"description"`
+	IsPrerelease bool       `json:"isPrerelease"`
+	IsDraft      bool       `json:"isDraft"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	PublishedAt  *time.Time `json:"publishedAt"`
+	Author       *struct {
+		Login     string `json:"login"`
+		AvatarURL string `json:"avatarUrl"`
+		URL       string `json:"url"`
+	} `json:"author"`
+	// the commit the tag points at, nil if the tag doesn't exist (anymore)
+	TagCommit *struct {
+		OID string `json:"oid"`
+	} `json:"tagCommit"`
+	ReleaseAssets struct {
+		Nodes []struct {
+			Name        string `json:"name"`
+			DownloadURL string `json:"downloadUrl"`
+		} `json:"nodes"`
+	} `json:"releaseAssets"`
+}
+
+type graphqlRepository struct {
+	Releases struct {
+		Nodes []graphqlRelease `json:"nodes"`
+	} `json:"releases"`
+}
+
+type graphqlResponse struct {
+	Data   map[string]*graphqlRepository `json:"data"`
+	Errors []struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path"`
+	} `json:"errors"`
+}
+
+// builds a query fetching the recent releases of every repo, aliased r0, r1, ... in order
+func buildGraphQLReleasesQuery(repos []RepositoryEntry) (string, map[string]interface{}) {
+	var params, fields []string
+	variables := make(map[string]interface{})
+	for i, repo := range repos {
+		params = append(params, fmt.Sprintf("$o%d: String!, $n%d: String!", i, i))
+		fields = append(fields, fmt.Sprintf("r%d: repository(owner: $o%d, name: $n%d) { ...releases }", i, i, i))
+		variables[fmt.Sprintf("o%d", i)] = repo.Owner
+		variables[fmt.Sprintf("n%d", i)] = repo.Repo
+	}
+	query := fmt.Sprintf(`query(%s) {
+%s
+}
+fragment releases on Repository {
+  releases(first: %d, orderBy: {field: CREATED_AT, direction: DESC}) {
+    nodes { databaseId tagName name url description isPrerelease isDraft createdAt publishedAt author { login avatarUrl url } tagCommit { oid } releaseAssets(first: 100) { nodes { name downloadUrl } } }
+  }
+}`, strings.Join(params, ", "), strings.Join(fields, "\n"), graphqlReleasesPerRepo)
+	return query, variables
+}
+
+// fetches the recent releases of all repos in as few graphql queries as possible, keyed by graphqlRepoKey
+func fetchGraphQLReleases(repo RepositoryEntry, token string, repos []RepositoryEntry) (map[string][]*github.RepositoryRelease, map[string]error) {
+	releases := make(map[string][]*github.RepositoryRelease)
+	errors := make(map[string]error)
+	client, err := withEnterpriseURLs(github.NewClient(githubHTTPClient(repo, rateLimitKey(repo, token))).WithAuthToken(token), repo)
+	if err != nil {
+		for _, r := range repos {
+			errors[graphqlRepoKey(r)] = err
+		}
+		return releases, errors
+	}
+	for start := 0; start < len(repos); start += graphqlReposPerQuery {
+		end := start + graphqlReposPerQuery
+		if end > len(repos) {
+			end = len(repos)
+		}
+		chunk := repos[start:end]
+		var resp graphqlResponse
+		if err := queryGraphQL(client, graphqlURL(repo), chunk, &resp); err != nil {
+			for _, r := range chunk {
+				errors[graphqlRepoKey(r)] = err
+			}
+			continue
+		}
+		for i, r := range chunk {
+			alias := fmt.Sprintf("r%d", i)
+			repository := resp.Data[alias]
+			if repository == nil {
+				errors[graphqlRepoKey(r)] = fmt.Errorf("failed to fetch releases through graphql: %s", graphqlError(resp, alias))
+				continue
+			}
+			releases[graphqlRepoKey(r)] = graphqlToReleases(repository.Releases.Nodes)
+		}
+	}
+	log.WithFields(log.Fields{
+		"endpoint": graphqlURL(repo),
+		"repos":    len(repos),
+		"queries":  (len(repos) + graphqlReposPerQuery - 1) / graphqlReposPerQuery,
+	}).Debug("Fetched releases through graphql")
+	return releases, errors
+}
+
+func queryGraphQL(client *github.Client, url string, repos []RepositoryEntry, resp *graphqlResponse) error {
+	query, variables := buildGraphQLReleasesQuery(repos)
+	req, err := client.NewRequest("POST", url, map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(context.Background(), req, resp)
+	return err
+}
+
+// the message of the error github reported for an aliased repository, if any
+func graphqlError(resp graphqlResponse, alias string) string {
+	for _, e := range resp.Errors {
+		if len(e.Path) > 0 && e.Path[0] == alias {
+			return e.Message
+		}
+	}
+	return "repository not found"
+}
+
+func graphqlToReleases(nodes []graphqlRelease) []*github.RepositoryRelease {
+	releases := make([]*github.RepositoryRelease, 0, len(nodes))
+	for _, node := range nodes {
+		release := &github.RepositoryRelease{
+			ID:         github.Int64(node.DatabaseID),
+			TagName:    github.String(node.TagName),
+			Name:       github.String(node.Name),
+			HTMLURL:    github.String(node.URL),
+			Body:       github.String(node.Description),
+			Prerelease: github.Bool(node.IsPrerelease),
+			Draft:      github.Bool(node.IsDraft),
+			CreatedAt:  &github.Timestamp{Time: node.CreatedAt},
+		}
+		if node.PublishedAt != nil {
+			release.PublishedAt = &github.Timestamp{Time: *node.PublishedAt}
+		}
+		// the tag commit stands in for the target, which unlike the rest api's branch name tells when the tag moved
+		if node.TagCommit != nil {
+			release.TargetCommitish = github.String(node.TagCommit.OID)
+		}
+		if node.Author != nil {
+			release.Author = &github.User{
+				Login:     github.String(node.Author.Login),
+				AvatarURL: github.String(node.Author.AvatarURL),
+				HTMLURL:   github.String(node.Author.URL),
+			}
+		}
+		for _, asset := range node.ReleaseAssets.Nodes {
+			release.Assets = append(release.Assets, &github.ReleaseAsset{
+				Name:               github.String(asset.Name),
+				BrowserDownloadURL: github.String(asset.DownloadURL),
+			})
+		}
+		releases = append(releases, release)
+	}
+	return releases
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphQLBatcher(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	queries := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/graphql" || r.Method != http.MethodPost {
+			t.Errorf("Unexpected %s request to %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer ghp_test" {
+			t.Errorf("Expected graphql request to be authenticated, got %s", r.Header.Get("Authorization"))
+		}
+		queries++
+		var body struct {
+			Variables map[string]string `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode graphql request: %v", err)
+		}
+		var data, errors []string
+		for i := 0; body.Variables[fmt.Sprintf("n%d", i)] != ""; i++ {
+			name := body.Variables[fmt.Sprintf("n%d", i)]
+			if name == "missing" {
+				data = append(data, fmt.Sprintf(`"r%d": null`, i))
+				errors = append(errors, fmt.Sprintf(`{"message": "Could not resolve to a Repository with the name 'rancher/missing'.", "path": ["r%d"]}`, i))
+				continue
+			}
+			data = append(data, fmt.Sprintf(`"r%d": {"releases": {"nodes": [
+				{"databaseId": 2, "tagName": "%s-v1.1.0-rc1", "isPrerelease": true, "createdAt": "2023-09-02T00:00:00Z", "publishedAt": "2023-09-02T00:00:00Z"},
+				{"databaseId": 1, "tagName": "%s-v1.0.0", "url": "https://github.com/rancher/%s/releases/tag/v1.0.0", "createdAt": "2023-09-01T00:00:00Z", "publishedAt": "2023-09-01T00:00:00Z", "author": {"login": "rancher-max"}, "tagCommit": {"oid": "0123456789abcdef0123456789abcdef01234567"}}
+			]}}`, i, name, name, name))
+		}
+		fmt.Fprintf(w, `{"data": {%s}, "errors": [%s]}`, strings.Join(data, ","), strings.Join(errors, ","))
+	}))
+	defer ts.Close()
+
+	batcher := newGraphQLBatcher(time.Hour)
+	for i := 0; i < 30; i++ {
+		batcher.register(RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: fmt.Sprintf("repo%d", i)})
+	}
+	batcher.register(RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "missing"})
+
+	repo := RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "repo7"}
+	releases, ok, err := batcher.releases(repo)
+	if !ok || err != nil {
+		t.Fatalf("Failed to get releases through graphql: %v", err)
+	}
+	if queries != 2 {
+		t.Errorf("Expected 31 repos to be fetched in 2 queries, got %d", queries)
+	}
+	if len(releases) != 2 || releases[1].GetTagName() != "repo7-v1.0.0" || !releases[0].GetPrerelease() {
+		t.Fatalf("Unexpected releases %v", releases)
+	}
+	if releases[1].Author.GetLogin() != "rancher-max" || releases[1].GetTargetCommitish() != "0123456789abcdef0123456789abcdef01234567" || releases[1].GetHTMLURL() != "https://github.com/rancher/repo7/releases/tag/v1.0.0" {
+		t.Errorf("Unexpected release details %v", releases[1])
+	}
+
+	if _, _, err := batcher.releases(RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "repo21"}); err != nil {
+		t.Errorf("Failed to get releases of another repo from the batch: %v", err)
+	}
+	if _, _, err := batcher.releases(RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "missing"}); err == nil || !strings.Contains(err.Error(), "Could not resolve") {
+		t.Errorf("Expected the graphql error of the missing repo, got %v", err)
+	}
+	if queries != 2 {
+		t.Errorf("Expected other repos to be served from the batch, got %d queries", queries)
+	}
+
+	batcher.maxAge = 0
+	if _, _, err := batcher.releases(repo); err != nil {
+		t.Errorf("Failed to refresh stale batch: %v", err)
+	}
+	if queries != 4 {
+		t.Errorf("Expected stale batch to be refetched, got %d queries", queries)
+	}
+
+	if _, ok, _ := batcher.releases(RepositoryEntry{Owner: "rancher", Repo: "rancher", Mode: ModeTags}); ok {
+		t.Errorf("Expected tag monitoring repos to not be fetched through graphql")
+	}
+}
+
+func TestGraphQLBatcherUnregister(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	batcher := newGraphQLBatcher(time.Hour)
+	kept := RepositoryEntry{Owner: "rancher", Repo: "rancher"}
+	stopped := RepositoryEntry{Owner: "rancher", Repo: "discovered"}
+	batcher.register(kept)
+	batcher.register(stopped)
+	batcher.unregister(stopped)
+	members := batcher.members(kept, "ghp_test")
+	if len(members) != 1 || members[0].Repo != "rancher" {
+		t.Errorf("Expected repos of stopped monitors to no longer be queried, got %v", members)
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	if url := graphqlURL(RepositoryEntry{}); url != "https://api.github.com/graphql" {
+		t.Errorf("Unexpected github.com graphql url %s", url)
+	}
+	if url := graphqlURL(RepositoryEntry{Url: "https://github.example.com/api/v3/"}); url != "https://github.example.com/api/graphql" {
+		t.Errorf("Unexpected enterprise graphql url %s", url)
+	}
+	if url := graphqlURL(RepositoryEntry{Url: "https://github.example.com"}); url != "https://github.example.com/api/graphql" {
+		t.Errorf("Unexpected enterprise graphql url %s", url)
+	}
+	if url := graphqlURL(RepositoryEntry{Url: "https://api.example.com/"}); url != "https://api.example.com/graphql" {
+		t.Errorf("Unexpected api host graphql url %s", url)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultHelmCredentialsEnv = "HELM_CREDENTIALS"
+
+type helmChartVersion struct {
+	Name       string   `yaml:"name"`
+	Version    string   `yaml:"version"`
+	AppVersion string   `yaml:"appVersion"`
+	Created    string   `yaml:"created"`
+	Digest     string   `yaml:"digest"`
+	Urls       []string `yaml:"urls"`
+}
+
+type helmIndex struct {
+	Entries map[string][]helmChartVersion `yaml:"entries"`
+}
+
+// fetches and parses the index.yaml of a chart repository
+func getHelmIndex(repo RepositoryEntry) (*helmIndex, error) {
+	credentialsEnv := repo.TokenEnv
+	if credentialsEnv == "" {
+		credentialsEnv = defaultHelmCredentialsEnv
+	}
+	indexURL := fmt.Sprintf("%s/index.yaml", repo.webURL())
+	req, err := http.NewRequest("GET", indexURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if credentials := os.Getenv(credentialsEnv); credentials != "" {
+		username, password, _ := strings.Cut(credentials, ":")
+		req.SetBasicAuth(username, password)
+	}
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chart repository returned %s for %s", resp.Status, indexURL)
+	}
+	var index helmIndex
+	if err := yaml.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// converts a chart version from an index into a release, chart versions with a semver prerelease are treated as prereleases
+//
+// tag names are the plain chart version when a single chart is monitored, otherwise name-version (the chart tarball naming)
+func helmChartToRelease(repo RepositoryEntry, chart helmChartVersion) *Release {
+	tagName := chart.Version
+	if repo.Repo == "" {
+		tagName = fmt.Sprintf("%s-%s", chart.Name, chart.Version)
+	}
+	chartURL := ""
+	if len(chart.Urls) > 0 {
+		chartURL = chart.Urls[0]
+		// urls in an index may be relative to the repository
+		if base, err := url.Parse(repo.webURL() + "/"); err == nil {
+			if resolved, err := base.Parse(chartURL); err == nil {
+				chartURL = resolved.String()
+			}
+		}
+	}
+	release := &Release{
+		RepositoryRelease: &github.RepositoryRelease{
+			TagName:    github.String(tagName),
+			Name:       github.String(fmt.Sprintf("%s-%s", chart.Name, chart.Version)),
+			Draft:      github.Bool(false),
+			Prerelease: github.Bool(isPrereleaseTag(chart.Version)),
+			TarballURL: github.String(chartURL),
+		},
+		Variables: map[string]string{
+			"REPO.URL":         repo.webURL(),
+			"CHART.NAME":       chart.Name,
+			"CHART.VERSION":    chart.Version,
+			"CHART.APPVERSION": chart.AppVersion,
+			"CHART.URL":        chartURL,
+			"CHART.DIGEST":     chart.Digest,
+		},
+	}
+	if created, err := time.Parse(time.RFC3339Nano, chart.Created); err == nil {
+		release.CreatedAt = &github.Timestamp{Time: created}
+		release.PublishedAt = release.CreatedAt
+	}
+	return release
+}
+
+// fetches every version of the monitored chart (or of all charts when no chart name is given) as releases
+func getAllHelmReleases(repo RepositoryEntry) ([]*Release, error) {
+	index, err := getHelmIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	var releases []*Release
+	for name, versions := range index.Entries {
+		if repo.Repo != "" && name != repo.Repo {
+			continue
+		}
+		for _, chart := range versions {
+			if chart.Name == "" {
+				chart.Name = name
+			}
+			releases = append(releases, helmChartToRelease(repo, chart))
+		}
+	}
+	if repo.Repo != "" && len(releases) == 0 {
+		return nil, fmt.Errorf("chart %s not found in repository %s", repo.Repo, repo.webURL())
+	}
+	return releases, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const helmIndexFile string = "testdata/index.yaml"
+
+func TestGetAllHelmReleases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/charts/index.yaml" {
+			t.Errorf("Expected URL path to be /charts/index.yaml, got %s", r.URL.Path)
+		}
+		http.ServeFile(w, r, helmIndexFile)
+	}))
+	defer server.Close()
+
+	repo := RepositoryEntry{
+		Source: SourceHelm,
+		Url:    server.URL + "/charts/",
+		Repo:   "releasebot",
+	}
+
+	releases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if len(releases) != 1 {
+		t.Fatalf("Expected 1 release, got %d", len(releases))
+	}
+	release := releases[0]
+	expectedVariables := map[string]string{
+		"CHART.NAME":       "releasebot",
+		"CHART.VERSION":    "0.1.2",
+		"CHART.APPVERSION": "0.1.2",
+		"CHART.URL":        "https://github.com/rancher-government-carbide/releasebot/releases/download/v0.1.2/releasebot-0.1.2.tgz",
+	}
+	for name, expected := range expectedVariables {
+		if release.Variables[name] != expected {
+			t.Errorf("Expected $%s to be %s, got %s", name, expected, release.Variables[name])
+		}
+	}
+	if release.GetTagName() != "0.1.2" || release.PublishedAt == nil {
+		t.Errorf("Unexpected release %s published at %v", release.GetTagName(), release.PublishedAt)
+	}
+
+	prereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get prereleases: %v", err)
+	}
+	if len(prereleases) != 1 {
+		t.Fatalf("Expected 1 prerelease, got %d", len(prereleases))
+	}
+	if url := prereleases[0].Variables["CHART.URL"]; url != server.URL+"/charts/charts/releasebot-0.2.0-rc1.tgz" {
+		t.Errorf("Expected relative chart url to be resolved against the repository, got %s", url)
+	}
+
+	repo.Repo = ""
+	allCharts, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get releases of all charts: %v", err)
+	}
+	if len(allCharts) != 2 || allCharts[0].GetTagName() != "releasebot-0.1.2" || allCharts[1].GetTagName() != "other-1.0.0" {
+		t.Errorf("Expected releasebot-0.1.2 and other-1.0.0 sorted by creation date")
+	}
+}
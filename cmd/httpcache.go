@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the cache of github api responses, persisted in the data folder when PERSIST is on
+var githubHTTPCache = newHTTPCache(httpCacheDir())
+
+func httpCacheDir() string {
+	if !persist {
+		return ""
+	}
+	return filepath.Join(DataFolderPath, "http-cache")
+}
+
+// a cached response along with the validators to revalidate it with
+type cachedResponse struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"lastModified"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// caches GET responses carrying an ETag or Last-Modified header and revalidates them with conditional requests,
+// github doesn't count 304 Not Modified responses against the rate limit
+type httpCache struct {
+	sync.Mutex
+	entries map[string]*cachedResponse
+	// directory the entries are persisted in, empty to only keep them in memory
+	dir string
+}
+
+func newHTTPCache(dir string) *httpCache {
+	return &httpCache{
+		entries: make(map[string]*cachedResponse),
+		dir:     dir,
+	}
+}
+
+// returns an http client revalidating its responses against the cache, making requests through the base transport
+func (c *httpCache) client(base http.RoundTripper) *http.Client {
+	return &http.Client{Transport: &cachingTransport{cache: c, base: base}}
+}
+
+func (c *httpCache) entryPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// returns the cached response of the url, loading it from the data folder if it isn't in memory yet
+func (c *httpCache) get(url string) *cachedResponse {
+	c.Lock()
+	defer c.Unlock()
+	if entry, ok := c.entries[url]; ok || c.dir == "" {
+		return entry
+	}
+	data, err := os.ReadFile(c.entryPath(url))
+	if err != nil {
+		return nil
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		return nil
+	}
+	c.entries[url] = &entry
+	return &entry
+}
+
+func (c *httpCache) set(entry *cachedResponse) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[entry.URL] = entry
+	if c.dir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.entryPath(entry.URL), data, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":   entry.URL,
+			"error": err,
+		}).Warn("Failed to persist cached response")
+	}
+}
+
+type cachingTransport struct {
+	cache *httpCache
+	base  http.RoundTripper
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	url := req.URL.String()
+	entry := t.cache.get(url)
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		// the fresh headers (e.g. rate limits) take precedence over the cached ones
+		header := entry.Header.Clone()
+		for key, values := range resp.Header {
+			header[key] = values
+		}
+		log.WithFields(log.Fields{
+			"url": url,
+		}).Debug("Response not modified, using cached response")
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+			ContentLength: int64(len(entry.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.cache.set(&cachedResponse{
+		URL:          url,
+		ETag:         etag,
+		LastModified: lastModified,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+	})
+	return resp, nil
+}
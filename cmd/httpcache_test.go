@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCachingTransport(t *testing.T) {
+	fullResponses, notModified := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/repos/rancher/rancher/git/matching-refs/tags" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		if r.URL.Path != "/api/v3/repos/rancher/rancher/releases" {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(5000-fullResponses))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `[{"tag_name": "v2.7.6"}, {"tag_name": "v2.7.5"}]`)
+	}))
+	defer ts.Close()
+
+	defaultCache := githubHTTPCache
+	defer func() { githubHTTPCache = defaultCache }()
+	dir := t.TempDir()
+	githubHTTPCache = newHTTPCache(dir)
+
+	repo := RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "rancher"}
+	for i := 0; i < 3; i++ {
+		releases, err := getAllGithubReleases(repo)
+		if err != nil {
+			t.Fatalf("Failed to get releases: %v", err)
+		}
+		if len(releases) != 2 || releases[0].GetTagName() != "v2.7.6" {
+			t.Fatalf("Unexpected releases %v", releases)
+		}
+	}
+	if fullResponses != 1 || notModified != 2 {
+		t.Errorf("Expected unchanged listings to be revalidated, got %d full and %d not modified responses", fullResponses, notModified)
+	}
+
+	// a restart revalidates the persisted response instead of fetching it again
+	githubHTTPCache = newHTTPCache(dir)
+	if releases, err := getAllGithubReleases(repo); err != nil || len(releases) != 2 {
+		t.Fatalf("Failed to get releases from persisted cache: %v", err)
+	}
+	if fullResponses != 1 || notModified != 3 {
+		t.Errorf("Expected persisted response to be revalidated, got %d full and %d not modified responses", fullResponses, notModified)
+	}
+
+	githubHTTPCache = newHTTPCache("")
+	if _, err := getAllGithubReleases(repo); err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if fullResponses != 2 {
+		t.Errorf("Expected an empty in memory cache to fetch the full response, got %d full responses", fullResponses)
+	}
+}
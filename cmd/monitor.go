@@ -1,45 +1,142 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
-
-	"github.com/google/go-github/v55/github"
 )
 
 var persist, _ = strconv.ParseBool(os.Getenv("PERSIST"))
 
+// every this many polls the full release history is fetched instead of only the newest releases,
+// catching releases that don't show up at the top of the listing (e.g. drafts published long after their creation)
+const fullScanInterval = 12
+
+// the known releases of a repo entry, shared by its release and prerelease monitors and the webhook receiver
+type releaseHistory struct {
+	sync.Mutex
+	repo     RepositoryEntry
+	releases map[string]bool
+	// what the known releases looked like when last seen, keyed by tag
+	fingerprints map[string]releaseFingerprint
+	// consecutive complete listings fingerprinted releases were missing from, keyed by tag
+	missing map[string]int
+	// tags seen pointing at another commit, keyed by tag
+	retags map[string]suspectedRetag
+	// releases whose actions are held back until their required assets are uploaded, keyed by tag
+	pending map[string]*pendingRelease
+}
+
+// release histories keyed by repo entry and release history file path, entries monitoring the same repo
+// (e.g. with different version ranges and payloads) each find its releases on their own
+var releaseHistories = struct {
+	sync.Mutex
+	histories map[string]*releaseHistory
+}{histories: make(map[string]*releaseHistory)}
+
+// returns the shared release history of a repo entry
+func getReleaseHistory(repo RepositoryEntry) *releaseHistory {
+	key := fmt.Sprintf("%d %s", repo.entry, releaseHistoryFilePath(repo))
+	releaseHistories.Lock()
+	defer releaseHistories.Unlock()
+	history, ok := releaseHistories.histories[key]
+	if !ok {
+		history = &releaseHistory{
+			repo:         repo,
+			releases:     make(map[string]bool),
+			fingerprints: loadReleaseFingerprints(repo),
+			missing:      make(map[string]int),
+			retags:       make(map[string]suspectedRetag),
+			pending:      make(map[string]*pendingRelease),
+		}
+		releaseHistories.histories[key] = history
+	}
+	return history
+}
+
+// adds the loaded releases to the history
+func (h *releaseHistory) merge(loadedReleasesMap map[string]bool) {
+	h.Lock()
+	defer h.Unlock()
+	for release, known := range loadedReleasesMap {
+		if known {
+			h.releases[release] = true
+		}
+	}
+}
+
+// checks whether the release is known
+func (h *releaseHistory) known(tag string) bool {
+	h.Lock()
+	defer h.Unlock()
+	return h.releases[tag]
+}
+
+// marks the releases as known, returning the ones that weren't already
+func (h *releaseHistory) checkForNewReleases(latestReleases []*Release) []*Release {
+	h.Lock()
+	defer h.Unlock()
+	newReleases := checkForNewReleases(latestReleases, h.releases)
+	for _, release := range newReleases {
+		h.fingerprints[release.GetTagName()] = fingerprintRelease(release)
+	}
+	if len(newReleases) > 0 {
+		h.saveFingerprints()
+	}
+	return newReleases
+}
+
 func Monitor(repos []RepositoryEntry, payloads []PayloadEntry) {
 	if persist {
 		if err := ensureDataFolder(DataFolderPath); err != nil {
 			log.Fatalf("%v", err)
 		}
 	}
+	if useGraphQL {
+		// monitors of the same repo poll at about the same time, so one batch serves them all
+		githubGraphQL = newGraphQLBatcher(pollInterval() / 2)
+	}
 	for i := 0; i < len(repos); i++ {
-		if repos[i].Prereleases {
-			go monitorRepo(repos[i], payloads, true)
+		if repos[i].Discover != nil {
+			go monitorDiscovery(repos[i], payloads)
+			continue
 		}
-		go monitorRepo(repos[i], payloads, false)
+		startRepoMonitors(context.Background(), repos[i], payloads)
+	}
+	if addr := os.Getenv("WEBHOOK_ADDR"); addr != "" {
+		go func() {
+			log.Fatalf("Webhook receiver failed: %v", serveWebhooks(addr, repos, payloads))
+		}()
+	}
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		go func() {
+			log.Fatalf("Metrics server failed: %v", serveMetrics(addr))
+		}()
 	}
 	for {
 		time.Sleep(time.Minute)
 	}
 }
 
-// periodically checks the github api for new releases
-func monitorRepo(repo RepositoryEntry, payloads []PayloadEntry, prereleases bool) {
-
-	repoName := fmt.Sprintf("%s/%s", repo.Owner, repo.Repo)
-	releaseType := "release"
-	if prereleases {
-		releaseType = "prerelease"
+// starts the release (and if enabled prerelease) monitors of a repo, which run until the context is cancelled
+func startRepoMonitors(ctx context.Context, repo RepositoryEntry, payloads []PayloadEntry) {
+	if githubGraphQL != nil {
+		githubGraphQL.register(repo)
+	}
+	if repo.Prereleases {
+		go monitorRepo(ctx, repo, payloads, true)
 	}
+	go monitorRepo(ctx, repo, payloads, false)
+}
 
+// sources env var interval, the minutes between polls of each repo
+func pollInterval() time.Duration {
 	interval, err := strconv.ParseInt(os.Getenv("interval"), 10, 64)
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -47,12 +144,42 @@ func monitorRepo(repo RepositoryEntry, payloads []PayloadEntry, prereleases bool
 		}).Info("Interval environment variable not set or invalid - defaulting to 5 minutes")
 		interval = 5
 	}
-	intervalTime := time.Duration(interval) * time.Minute
+	return time.Duration(interval) * time.Minute
+}
+
+// sleeps for the given duration, returns false if the context was cancelled in the meantime
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// periodically checks the github api for new releases
+func monitorRepo(ctx context.Context, repo RepositoryEntry, payloads []PayloadEntry, prereleases bool) {
+
+	repoName := repo.fullName()
+	if repo.source() != SourceGithub {
+		repoName = fmt.Sprintf("%s:%s", repo.source(), repoName)
+	}
+	releaseType := "release"
+	if prereleases {
+		releaseType = "prerelease"
+	}
+
+	intervalTime := pollInterval()
+	defer githubRateLimits.addMonitor(repo)()
+	if githubGraphQL != nil {
+		defer githubGraphQL.unregister(repo)
+	}
 
 	loadInitialReleases := loadReleasesFromGithub
 	if persist {
 		loadInitialReleases = loadReleasesFromFile
 	}
+	history := getReleaseHistory(repo)
 LoadInitialReleases:
 	loadedReleasesMap, err := loadInitialReleases(repo, prereleases)
 	if err != nil {
@@ -61,13 +188,24 @@ LoadInitialReleases:
 			"repoName":    repoName,
 			"error":       err,
 		}).Error("Failed to retrieve initial releases, retrying...")
-		time.Sleep(intervalTime)
+		if !sleepContext(ctx, githubRateLimits.nextPoll(repo, intervalTime)) {
+			return
+		}
 		goto LoadInitialReleases
 	}
+	history.merge(loadedReleasesMap)
+	if repo.source() == SourceChannels && persist {
+		history.forgetSupersededChannelReleases(recordedChannelVersions(releaseHistoryFilePath(repo)))
+	}
 
+	// the initial releases were a full scan
+	polls := 1
+	fullScan := false
 	for {
 
-		loadedReleasesStrings := stringifyLoadedReleases(loadedReleasesMap)
+		history.Lock()
+		loadedReleasesStrings := stringifyLoadedReleases(history.releases)
+		history.Unlock()
 		log.WithFields(log.Fields{
 			"releaseType": releaseType,
 			"repoName":    repoName,
@@ -76,53 +214,145 @@ LoadInitialReleases:
 		}).Debug()
 
 	LoadNewReleases:
-		latestReleases, err := getLatestReleases(repo.Owner, repo.Repo, prereleases, -1)
+		var latestReleases []*Release
+		complete := completeListing(repo, fullScan || polls%fullScanInterval == 0)
+		if fullScan || polls%fullScanInterval == 0 {
+			latestReleases, err = getLatestReleases(repo, prereleases, -1)
+		} else {
+			latestReleases, err = getLatestUnknownReleases(repo, prereleases, history.known)
+		}
 		if err != nil {
 			log.WithFields(log.Fields{
 				"releaseType": releaseType,
 				"repoName":    repoName,
 				"error":       err,
 			}).Error("Failed to get latest releases")
-			time.Sleep(intervalTime)
+			// releases may have been missed while failing, so the next poll scans the full history
+			fullScan = true
+			if !sleepContext(ctx, githubRateLimits.nextPoll(repo, intervalTime)) {
+				return
+			}
 			goto LoadNewReleases
 		}
+		polls++
+		fullScan = false
+
+		for _, release := range filterIgnored(repo, history.checkForChangedReleases(latestReleases)) {
+			log.WithFields(log.Fields{
+				"releaseType": releaseType,
+				"repoName":    repoName,
+				"release":     release.GetTagName(),
+				"event":       release.event(),
+				"changes":     release.Variables["RELEASE.CHANGES"],
+			}).Info("Found changed release")
+			if err := resolveReleaseDetails(repo, release); err != nil {
+				log.WithFields(log.Fields{
+					"releaseType": releaseType,
+					"repoName":    repoName,
+					"release":     release.GetTagName(),
+					"error":       err,
+				}).Warn("Failed to resolve release details")
+			}
+			runReleaseActions(repo, release, payloads, log.Fields{"releaseType": releaseType, "repoName": repoName})
+		}
 
-		newReleases := checkForNewReleases(latestReleases, loadedReleasesMap)
+		for _, release := range filterIgnored(repo, history.checkForDeletedReleases(latestReleases, prereleases, complete)) {
+			log.WithFields(log.Fields{
+				"releaseType": releaseType,
+				"repoName":    repoName,
+				"release":     release.GetTagName(),
+				"commit":      release.Variables["RELEASE.COMMIT"],
+			}).Warn("Release was deleted")
+			runReleaseActions(repo, release, payloads, log.Fields{"releaseType": releaseType, "repoName": repoName})
+		}
+
+		foundReleases := history.checkForNewReleases(latestReleases)
+		if repo.source() == SourceChannels {
+			history.forgetSupersededChannelReleases(currentChannelVersions(latestReleases))
+		}
+		newReleases := filterIgnored(repo, foundReleases)
+		recordIgnoredReleases(repo, foundReleases, newReleases)
 		if len(newReleases) == 0 {
 			log.WithFields(log.Fields{
 				"releaseType": releaseType,
 				"repoName":    repoName,
 			}).Info("No new releases")
 		} else {
+			markNewestReleases(repo, newReleases, history.knownReleases(repo, latestReleases))
 			for _, release := range newReleases {
 				log.WithFields(log.Fields{
 					"releaseType": releaseType,
 					"repoName":    repoName,
 					"release":     release.GetTagName(),
 				}).Info("Found new release")
-				errors := newReleaseActions(repo, release, payloads)
-				if len(errors) != 0 {
-					for _, err := range errors {
-						log.WithFields(log.Fields{
-							"releaseType": releaseType,
-							"repoName":    repoName,
-							"release":     release.GetTagName(),
-							"actionError": err,
-						}).Error("Action failed")
-					}
+				if err := resolveReleaseDetails(repo, release); err != nil {
+					log.WithFields(log.Fields{
+						"releaseType": releaseType,
+						"repoName":    repoName,
+						"release":     release.GetTagName(),
+						"error":       err,
+					}).Warn("Failed to resolve release details")
 				}
+				if missing := missingAssets(repo, release); len(missing) > 0 {
+					log.WithFields(log.Fields{
+						"releaseType":   releaseType,
+						"repoName":      repoName,
+						"release":       release.GetTagName(),
+						"missingAssets": strings.Join(missing, ", "),
+					}).Info("Waiting for release assets")
+					history.addPending(release)
+					continue
+				}
+				runReleaseActions(repo, release, payloads, log.Fields{"releaseType": releaseType, "repoName": repoName})
 			}
 		}
 
-		time.Sleep(intervalTime)
+		ready, timedOut := history.checkPendingReleases(repo, latestReleases)
+		for _, release := range ready {
+			log.WithFields(log.Fields{
+				"releaseType": releaseType,
+				"repoName":    repoName,
+				"release":     release.GetTagName(),
+			}).Info("Release assets complete")
+			runReleaseActions(repo, release, payloads, log.Fields{"releaseType": releaseType, "repoName": repoName})
+		}
+		for _, release := range timedOut {
+			log.WithFields(log.Fields{
+				"releaseType":   releaseType,
+				"repoName":      repoName,
+				"release":       release.GetTagName(),
+				"missingAssets": release.Variables["RELEASE.MISSINGASSETS"],
+			}).Warn("Timed out waiting for release assets")
+			runReleaseActions(repo, release, payloads, log.Fields{"releaseType": releaseType, "repoName": repoName})
+		}
+
+		if !sleepContext(ctx, githubRateLimits.nextPoll(repo, intervalTime)) {
+			log.WithFields(log.Fields{
+				"releaseType": releaseType,
+				"repoName":    repoName,
+			}).Info("Stopped monitoring")
+			return
+		}
+	}
+}
+
+// runs the actions of a release, logging any that failed along with the given fields
+func runReleaseActions(repo RepositoryEntry, release *Release, payloads []PayloadEntry, fields log.Fields) {
+	errors := newReleaseActions(repo, release, payloads)
+	for _, err := range errors {
+		log.WithFields(fields).WithFields(log.Fields{
+			"release":     release.GetTagName(),
+			"event":       release.event(),
+			"actionError": err,
+		}).Error("Action failed")
 	}
 }
 
 // collection of actions to take when a new release is found
-func newReleaseActions(repo RepositoryEntry, release *github.RepositoryRelease, payloads []PayloadEntry) []error {
+func newReleaseActions(repo RepositoryEntry, release *Release, payloads []PayloadEntry) []error {
 	var errors []error
-	if repo.Slack {
-		err := slacknotif(release, repo.Owner, repo.Repo)
+	if repo.Slack && subscribed(repo.SlackEvents, release.event()) && release.satisfies(repo.Policy) {
+		err := slacknotif(release, repo)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("error sending Slack notification: %v", err))
 		}
@@ -131,8 +361,9 @@ func newReleaseActions(repo RepositoryEntry, release *github.RepositoryRelease,
 	if err != nil {
 		errors = append(errors, fmt.Errorf("error sending payload: %v", err))
 	}
-	if persist {
-		err := writeReleaseToFile(release.GetTagName(), repo.Owner, repo.Repo)
+	// edited and promoted releases are already in the release history file
+	if persist && (release.event() == EventPublished || release.event() == EventAssetsTimedOut) {
+		err := writeReleaseToFile(release.GetTagName(), repo)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("error writing release to file: %v", err))
 		}
@@ -143,10 +374,34 @@ func newReleaseActions(repo RepositoryEntry, release *github.RepositoryRelease,
 	return nil
 }
 
+// appends the found releases the repo ignores (those missing from kept) to the release history file, so they
+// aren't evaluated again after a restart, the kept ones are appended once their actions ran
+func recordIgnoredReleases(repo RepositoryEntry, found []*Release, kept []*Release) {
+	if !persist {
+		return
+	}
+	keep := make(map[string]bool)
+	for _, release := range kept {
+		keep[release.GetTagName()] = true
+	}
+	for _, release := range found {
+		if keep[release.GetTagName()] {
+			continue
+		}
+		if err := writeReleaseToFile(release.GetTagName(), repo); err != nil {
+			log.WithFields(log.Fields{
+				"repoName": repo.fullName(),
+				"release":  release.GetTagName(),
+				"error":    err,
+			}).Error("Failed to record ignored release")
+		}
+	}
+}
+
 // Checks if any releases in the array are new. If there are some returns an array of the new ones
 // along with the newest timestamp among them. The timestamp is unchanged from the input if there are no new releases.
-func checkForNewReleases(latestReleases []*github.RepositoryRelease, loadedReleasesMap map[string]bool) []*github.RepositoryRelease {
-	var newReleases []*github.RepositoryRelease
+func checkForNewReleases(latestReleases []*Release, loadedReleasesMap map[string]bool) []*Release {
+	var newReleases []*Release
 	for _, release := range latestReleases {
 		if !loadedReleasesMap[release.GetTagName()] {
 			newReleases = append(newReleases, release)
@@ -157,7 +412,7 @@ func checkForNewReleases(latestReleases []*github.RepositoryRelease, loadedRelea
 }
 
 func loadReleasesFromFile(repo RepositoryEntry, prereleases bool) (map[string]bool, error) {
-	releaseFile := fmt.Sprintf(ReleaseFileFormat, DataFolderPath, repo.Owner, repo.Repo)
+	releaseFile := releaseHistoryFilePath(repo)
 	var releaseMap map[string]bool
 	_, err := os.Stat(releaseFile)
 	if err == nil {
@@ -187,7 +442,7 @@ func loadReleasesFromFile(repo RepositoryEntry, prereleases bool) (map[string]bo
 // loads initial batch of releases into a hashmap and returns such along with the latest release timestamp
 func loadReleasesFromGithub(repo RepositoryEntry, prereleases bool) (map[string]bool, error) {
 	loadedReleasesMap := make(map[string]bool)
-	baseReleases, err := getLatestReleases(repo.Owner, repo.Repo, prereleases, -1)
+	baseReleases, err := getLatestReleases(repo, prereleases, -1)
 	if err != nil {
 		return loadedReleasesMap, err
 	}
@@ -208,8 +463,8 @@ func stringifyLoadedReleases(loadedReleasesMap map[string]bool) []string {
 	return loadedReleasesMessage
 }
 
-func writeReleaseToFile(releaseTag string, repoOwner string, repoName string) error {
-	releaseHistoryFile := fmt.Sprintf(ReleaseFileFormat, DataFolderPath, repoOwner, repoName)
+func writeReleaseToFile(releaseTag string, repo RepositoryEntry) error {
+	releaseHistoryFile := releaseHistoryFilePath(repo)
 	err := appendStringToFile(releaseTag, releaseHistoryFile)
 	if err != nil {
 		return err
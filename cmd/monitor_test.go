@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
+
+	"github.com/google/go-github/v55/github"
 )
 
 func Test_stringifyLoadedReleases(t *testing.T) {
@@ -37,3 +42,54 @@ func Test_stringifyLoadedReleases(t *testing.T) {
 	}
 
 }
+
+func TestRecordIgnoredReleases(t *testing.T) {
+	defer func(enabled bool, folder string) { persist, DataFolderPath = enabled, folder }(persist, DataFolderPath)
+	persist, DataFolderPath = true, t.TempDir()
+
+	var repo RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"owner": "rancher", "repo": "rancher", "versions": ">= 2.8"}`), &repo); err != nil {
+		t.Fatalf("Failed to parse repo: %v", err)
+	}
+	found := []*Release{
+		{RepositoryRelease: &github.RepositoryRelease{TagName: github.String("v2.7.9")}},
+		{RepositoryRelease: &github.RepositoryRelease{TagName: github.String("v2.8.1")}},
+	}
+	recordIgnoredReleases(repo, found, filterIgnored(repo, found))
+
+	recorded, err := readMapFromFile(releaseHistoryFilePath(repo))
+	if err != nil {
+		t.Fatalf("Failed to read release history: %v", err)
+	}
+	if !recorded["v2.7.9"] || recorded["v2.8.1"] {
+		t.Errorf("Expected only the ignored release to be recorded, got %v", recorded)
+	}
+}
+
+func TestReleaseHistoriesOfEntriesForTheSameRepo(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "repos.json")
+	if err := os.WriteFile(config, []byte(`[
+		{"owner": "rancher", "repo": "histories", "versions": "~2.8", "payloads": ["v2.8"]},
+		{"owner": "rancher", "repo": "histories", "versions": "~2.9", "payloads": ["v2.9"]}
+	]`), 0644); err != nil {
+		t.Fatalf("Failed to write repo config: %v", err)
+	}
+	t.Setenv("RELEASEBOT_REPOS", config)
+	var repos []RepositoryEntry
+	if err := loadRepos(&repos); err != nil {
+		t.Fatalf("Failed to load repos: %v", err)
+	}
+
+	latest := func() []*Release {
+		return wrapReleases([]*github.RepositoryRelease{{TagName: github.String("v2.8.9")}, {TagName: github.String("v2.9.1")}})
+	}
+	for _, repo := range repos {
+		newReleases := filterIgnored(repo, getReleaseHistory(repo).checkForNewReleases(latest()))
+		if len(newReleases) != 1 || !repo.Versions.contains(newReleases[0].GetTagName()) {
+			t.Errorf("Expected the entry for %s to find its release, got %v", repo.Versions, newReleases)
+		}
+	}
+	if getReleaseHistory(repos[0]) == getReleaseHistory(repos[1]) {
+		t.Errorf("Expected entries for the same repo not to share their release history")
+	}
+}
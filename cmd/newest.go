@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v55/github"
+)
+
+// supported values for the policy field of a RepositoryEntry or PayloadEntry
+const (
+	PolicyAll            = "all"
+	PolicyNewestOverall  = "newest-overall"
+	PolicyNewestPerMinor = "newest-per-minor"
+	PolicyNewestPerMajor = "newest-per-major"
+)
+
+// which new releases fire actions, either all of them or only those with the highest version (of their release line)
+type Policy string
+
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var policy string
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+	switch policy {
+	case "", PolicyAll, PolicyNewestOverall, PolicyNewestPerMinor, PolicyNewestPerMajor:
+		*p = Policy(policy)
+		return nil
+	default:
+		return fmt.Errorf("unknown policy %q", policy)
+	}
+}
+
+// returns the policy of the payload, falling back to the policy of the repo
+func (p PayloadEntry) policy(repo RepositoryEntry) Policy {
+	if p.Policy != "" {
+		return p.Policy
+	}
+	return repo.Policy
+}
+
+// checks whether the release fires actions under the policy
+func (r *Release) satisfies(policy Policy) bool {
+	if policy == "" || policy == PolicyAll || r.Newest == nil {
+		return true
+	}
+	return r.Newest[string(policy)]
+}
+
+// returns the known releases the newest policies compare against, the latest listing along with the tags of the
+// release history it doesn't cover (named as they were when found, if fingerprinted)
+func (h *releaseHistory) knownReleases(repo RepositoryEntry, latestReleases []*Release) []*Release {
+	h.Lock()
+	defer h.Unlock()
+	known := append([]*Release(nil), latestReleases...)
+	listed := make(map[string]bool)
+	for _, release := range latestReleases {
+		listed[release.GetTagName()] = true
+	}
+	for tag, isKnown := range h.releases {
+		if !isKnown || listed[tag] {
+			continue
+		}
+		release := &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String(tag)}}
+		if fingerprint, ok := h.fingerprints[tag]; ok && fingerprint.Name != "" {
+			release.Name = github.String(fingerprint.Name)
+		}
+		if version := knownTagVersion(repo, tag); version != tag {
+			release.Variables = map[string]string{"RELEASE.TAGNAME": version}
+		}
+		known = append(known, release)
+	}
+	return known
+}
+
+// records which of the newest policies the new releases satisfy, by comparing their versions against
+// the versions of all known releases (including the new ones) the repo doesn't ignore
+//
+// prereleases don't count against releases and releases whose tag isn't a version satisfy every policy
+func markNewestReleases(repo RepositoryEntry, releases []*Release, knownReleases []*Release) {
+	var known []*semver.Version
+	for _, release := range knownReleases {
+		if ignored(repo, release) {
+			continue
+		}
+		if version, err := semver.NewVersion(release.version()); err == nil {
+			known = append(known, version)
+		}
+	}
+	for _, release := range releases {
+		version, err := semver.NewVersion(release.version())
+		if err != nil {
+			continue
+		}
+		release.Newest = map[string]bool{
+			PolicyNewestOverall:  true,
+			PolicyNewestPerMinor: true,
+			PolicyNewestPerMajor: true,
+		}
+		for _, other := range known {
+			if !other.GreaterThan(version) || (version.Prerelease() == "" && other.Prerelease() != "") {
+				continue
+			}
+			release.Newest[PolicyNewestOverall] = false
+			if other.Major() == version.Major() {
+				release.Newest[PolicyNewestPerMajor] = false
+				if other.Minor() == version.Minor() {
+					release.Newest[PolicyNewestPerMinor] = false
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestMarkNewestReleases(t *testing.T) {
+	repo := RepositoryEntry{Policy: PolicyNewestPerMinor}
+	var releases []*Release
+	for _, tag := range []string{"v2.7.15", "v2.8.9", "v2.9.3", "v2.8.8", "nightly"} {
+		releases = append(releases, &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String(tag)}})
+	}
+	history := getReleaseHistory(RepositoryEntry{Owner: "newest", Repo: "per-minor"})
+	history.merge(map[string]bool{"v2.7.14": true, "v2.8.10": true, "v2.9.2": true, "v3.0.0-rc1": true})
+	history.checkForNewReleases(releases)
+	markNewestReleases(repo, releases, history.knownReleases(repo, releases))
+
+	expected := map[string]map[Policy]bool{
+		"v2.7.15": {PolicyAll: true, PolicyNewestOverall: false, PolicyNewestPerMajor: false, PolicyNewestPerMinor: true},
+		"v2.8.9":  {PolicyAll: true, PolicyNewestOverall: false, PolicyNewestPerMajor: false, PolicyNewestPerMinor: false},
+		"v2.9.3":  {PolicyAll: true, PolicyNewestOverall: true, PolicyNewestPerMajor: true, PolicyNewestPerMinor: true},
+		"v2.8.8":  {PolicyAll: true, PolicyNewestOverall: false, PolicyNewestPerMajor: false, PolicyNewestPerMinor: false},
+		"nightly": {PolicyAll: true, PolicyNewestOverall: true, PolicyNewestPerMajor: true, PolicyNewestPerMinor: true},
+	}
+	for _, release := range releases {
+		for policy, satisfied := range expected[release.GetTagName()] {
+			if release.satisfies(policy) != satisfied {
+				t.Errorf("Expected %s to satisfy %s: %v", release.GetTagName(), policy, satisfied)
+			}
+		}
+	}
+
+	payload := PayloadEntry{Policy: PolicyNewestOverall}
+	if payload.policy(repo) != PolicyNewestOverall || (PayloadEntry{}).policy(repo) != PolicyNewestPerMinor {
+		t.Errorf("Expected the payload policy to take precedence over the repo policy")
+	}
+	if err := json.Unmarshal([]byte(`{"policy": "newest-per-patch"}`), &repo); err == nil {
+		t.Errorf("Expected an unknown policy to fail parsing")
+	}
+}
+
+func TestChannelReleaseVersions(t *testing.T) {
+	var repo RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"source": "channels", "versions": ">= 1.28", "policy": "newest-overall", "prereleasePatterns": ["-rc\\d+\\+"]}`), &repo); err != nil {
+		t.Fatalf("Failed to parse repo: %v", err)
+	}
+	channel := func(name string, version string) *Release {
+		return &Release{
+			RepositoryRelease: &github.RepositoryRelease{TagName: github.String(name + channelTagSeparator + version), Prerelease: github.Bool(false)},
+			Variables:         map[string]string{"RELEASE.TAGNAME": version},
+		}
+	}
+	releases := filterVersions(repo, []*Release{channel("stable", "v1.28.3+k3s1"), channel("v1.27", "v1.27.9+k3s1"), channel("testing", "v1.29.0-rc1+k3s1")})
+	if len(releases) != 2 {
+		t.Fatalf("Expected the channels in the version range to be kept, got %d", len(releases))
+	}
+	if !classifiedPrerelease(repo, releases[1]) || classifiedPrerelease(repo, releases[0]) {
+		t.Errorf("Expected only the testing channel to be classified as a prerelease")
+	}
+
+	latest := []*Release{channel("stable", "v1.28.3+k3s1")}
+	history := getReleaseHistory(RepositoryEntry{Source: SourceChannels, Url: "https://channels.example.com"})
+	history.merge(map[string]bool{"latest@v1.29.1+k3s1": true, "stable@v1.28.3+k3s1": true})
+	markNewestReleases(repo, latest, history.knownReleases(repo, latest))
+	if latest[0].satisfies(PolicyNewestOverall) {
+		t.Errorf("Expected the stable channel to be older than the latest channel")
+	}
+}
+
+func TestMarkNewestReleasesFilteredByName(t *testing.T) {
+	var repo RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"policy": "newest-overall", "exclude": ["(?i)hotfix"], "filterNames": true}`), &repo); err != nil {
+		t.Fatalf("Failed to parse repo: %v", err)
+	}
+	known := []*Release{
+		{RepositoryRelease: &github.RepositoryRelease{TagName: github.String("v2.9.0"), Name: github.String("v2.9.0 hotfix build")}},
+		{RepositoryRelease: &github.RepositoryRelease{TagName: github.String("v2.8.5"), Name: github.String("v2.8.5")}},
+	}
+	markNewestReleases(repo, known[1:], known)
+	if !known[1].satisfies(PolicyNewestOverall) {
+		t.Errorf("Expected a release excluded by name not to count as newer")
+	}
+}
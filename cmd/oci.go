@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+const defaultOCICredentialsEnv = "OCI_CREDENTIALS"
+
+// page size requested when listing tags
+const ociPageSize = 100
+
+const ociCreatedAnnotation = "org.opencontainers.image.created"
+
+var ociManifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// config media types whose blobs carry a "created" field
+var ociImageConfigMediaTypes = map[string]bool{
+	"application/vnd.oci.image.config.v1+json":       true,
+	"application/vnd.docker.container.image.v1+json": true,
+}
+
+var ociLinkNextRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+var ociChallengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+type ociManifest struct {
+	MediaType   string            `json:"mediaType"`
+	Annotations map[string]string `json:"annotations"`
+	Config      struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// a client for a single repository of an oci distribution registry
+//
+// handles both basic auth and the token (bearer) auth flow described by the registry's WWW-Authenticate challenge
+type ociRegistry struct {
+	baseURL     string
+	name        string
+	credentials string
+	token       string
+	basic       bool
+	client      *http.Client
+}
+
+func newOCIRegistry(repo RepositoryEntry) *ociRegistry {
+	credentialsEnv := repo.TokenEnv
+	if credentialsEnv == "" {
+		credentialsEnv = defaultOCICredentialsEnv
+	}
+	return &ociRegistry{
+		baseURL:     repo.webURL(),
+		name:        ociName(repo),
+		credentials: os.Getenv(credentialsEnv),
+		client:      &http.Client{},
+	}
+}
+
+// returns the repository name within the registry (owner may be empty for top level repositories)
+func ociName(repo RepositoryEntry) string {
+	if repo.Owner == "" {
+		return repo.Repo
+	}
+	return fmt.Sprintf("%s/%s", repo.Owner, repo.Repo)
+}
+
+// returns the image reference of the repository, e.g. ghcr.io/owner/repo
+func ociReference(repo RepositoryEntry) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(repo.webURL(), "https://"), "http://")
+	return fmt.Sprintf("%s/%s", host, ociName(repo))
+}
+
+func (r *ociRegistry) authorize(req *http.Request) {
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	} else if r.basic {
+		username, password, _ := strings.Cut(r.credentials, ":")
+		req.SetBasicAuth(username, password)
+	}
+}
+
+// performs a request against the registry, answering an authentication challenge once if one is received
+func (r *ociRegistry) do(method string, requestURL string, accept []string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, requestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		r.authorize(req)
+		return req, nil
+	}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+	if err := r.answerChallenge(resp.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, err
+	}
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	return r.client.Do(req)
+}
+
+// handles a WWW-Authenticate challenge, fetching a bearer token from the token service if requested
+func (r *ociRegistry) answerChallenge(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.credentials == "" {
+			return fmt.Errorf("registry %s requires credentials", r.baseURL)
+		}
+		r.basic = true
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+
+	values := make(map[string]string)
+	for _, match := range ociChallengeParamRegex.FindAllStringSubmatch(params, -1) {
+		values[match[1]] = match[2]
+	}
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return fmt.Errorf("invalid registry token realm %q", values["realm"])
+	}
+	query := tokenURL.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", r.name)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.credentials != "" {
+		username, password, _ := strings.Cut(r.credentials, ":")
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token service returned %s", resp.Status)
+	}
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return err
+	}
+	r.token = tokenResponse.Token
+	if r.token == "" {
+		r.token = tokenResponse.AccessToken
+	}
+	if r.token == "" {
+		return fmt.Errorf("registry token service returned no token")
+	}
+	return nil
+}
+
+// lists all tags of the repository following the Link header for pagination
+func (r *ociRegistry) listTags() ([]string, error) {
+	nextURL := fmt.Sprintf("%s/v2/%s/tags/list?n=%d", r.baseURL, r.name, ociPageSize)
+	var allTags []string
+	for nextURL != "" {
+		resp, err := r.do("GET", nextURL, []string{"application/json"})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("registry returned %s for %s", resp.Status, nextURL)
+		}
+		var tagList struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&tagList)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		allTags = append(allTags, tagList.Tags...)
+
+		nextURL = ""
+		if match := ociLinkNextRegex.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			next, err := resp.Request.URL.Parse(match[1])
+			if err != nil {
+				return nil, err
+			}
+			nextURL = next.String()
+		}
+	}
+	return allTags, nil
+}
+
+// fetches a manifest by tag or digest, returning its digest along with the parsed manifest
+func (r *ociRegistry) getManifest(reference string) (string, *ociManifest, error) {
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", r.baseURL, r.name, reference)
+	resp, err := r.do("GET", manifestURL, ociManifestMediaTypes)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("registry returned %s for %s", resp.Status, manifestURL)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return "", nil, err
+	}
+	return digest, &manifest, nil
+}
+
+// determines when the image behind a manifest was created, returns nil if that can't be determined
+//
+// the created annotation is preferred, otherwise the image config is consulted (using the first manifest of an index)
+func (r *ociRegistry) getCreated(manifest *ociManifest) (*time.Time, error) {
+	if created, err := time.Parse(time.RFC3339, manifest.Annotations[ociCreatedAnnotation]); err == nil {
+		return &created, nil
+	}
+	if len(manifest.Manifests) > 0 {
+		_, child, err := r.getManifest(manifest.Manifests[0].Digest)
+		if err != nil {
+			return nil, err
+		}
+		manifest = child
+		if created, err := time.Parse(time.RFC3339, manifest.Annotations[ociCreatedAnnotation]); err == nil {
+			return &created, nil
+		}
+	}
+	if !ociImageConfigMediaTypes[manifest.Config.MediaType] {
+		return nil, nil
+	}
+	blobURL := fmt.Sprintf("%s/v2/%s/blobs/%s", r.baseURL, r.name, manifest.Config.Digest)
+	resp, err := r.do("GET", blobURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned %s for %s", resp.Status, blobURL)
+	}
+	var config struct {
+		Created *time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, err
+	}
+	return config.Created, nil
+}
+
+// fetches all tags of an oci repository as releases, tags with a semver prerelease identifier are treated as prereleases
+//
+// digests and creation times cost extra requests per tag so are only resolved for new releases (see resolveOCIReleaseDetails)
+func getAllOCIReleases(repo RepositoryEntry) ([]*Release, error) {
+	registry := newOCIRegistry(repo)
+	if registry.credentials == "" {
+		log.WithFields(log.Fields{
+			"registry": registry.baseURL,
+		}).Debug("No provided registry credentials - requests to the registry will be anonymous")
+	}
+	tags, err := registry.listTags()
+	if err != nil {
+		return nil, err
+	}
+	var releases []*Release
+	for _, tag := range tags {
+		releases = append(releases, &Release{
+			RepositoryRelease: &github.RepositoryRelease{
+				TagName:    github.String(tag),
+				Name:       github.String(fmt.Sprintf("%s:%s", ociName(repo), tag)),
+				Draft:      github.Bool(false),
+				Prerelease: github.Bool(isPrereleaseTag(tag)),
+			},
+			Variables: map[string]string{
+				"REPO.URL": ociReference(repo),
+			},
+		})
+	}
+	return releases, nil
+}
+
+// resolves the digest and creation time of an oci tag
+func resolveOCIReleaseDetails(repo RepositoryEntry, release *Release) error {
+	registry := newOCIRegistry(repo)
+	digest, manifest, err := registry.getManifest(release.GetTagName())
+	if err != nil {
+		return err
+	}
+	if release.Variables == nil {
+		release.Variables = make(map[string]string)
+	}
+	release.Variables["RELEASE.DIGEST"] = digest
+	created, err := registry.getCreated(manifest)
+	if err != nil {
+		return err
+	}
+	if created != nil {
+		release.CreatedAt = &github.Timestamp{Time: *created}
+		release.PublishedAt = release.CreatedAt
+		release.Variables["RELEASE.CREATED"] = release.CreatedAt.String()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// minimal stand-in for a registry:2 style registry using token authentication
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "robot" || password != "secret" {
+				t.Errorf("Expected token request with basic credentials, got %q:%q", username, password)
+			}
+			if scope := r.URL.Query().Get("scope"); scope != "repository:charts/releasebot:pull" {
+				t.Errorf("Unexpected token scope %s", scope)
+			}
+			fmt.Fprint(w, `{"token": "registry-token"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:charts/releasebot:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/charts/releasebot/tags/list":
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/charts/releasebot/tags/list?n=100&last=0.1.1>; rel="next"`)
+				fmt.Fprint(w, `{"name": "charts/releasebot", "tags": ["0.1.0", "0.1.1"]}`)
+			} else {
+				fmt.Fprint(w, `{"name": "charts/releasebot", "tags": ["0.2.0-rc1"]}`)
+			}
+		case "/v2/charts/releasebot/manifests/0.1.1":
+			w.Header().Set("Docker-Content-Digest", "sha256:manifest011")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"config": map[string]string{
+					"mediaType": "application/vnd.oci.image.config.v1+json",
+					"digest":    "sha256:config011",
+				},
+			})
+		case "/v2/charts/releasebot/blobs/sha256:config011":
+			fmt.Fprint(w, `{"created": "2023-07-16T12:00:00Z"}`)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestGetAllOCIReleases(t *testing.T) {
+	server := newTestRegistry(t)
+	defer server.Close()
+
+	t.Setenv("TEST_OCI_CREDENTIALS", "robot:secret")
+	repo := RepositoryEntry{
+		Source:   SourceOCI,
+		Url:      server.URL,
+		TokenEnv: "TEST_OCI_CREDENTIALS",
+		Owner:    "charts",
+		Repo:     "releasebot",
+	}
+
+	releases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("Expected 2 releases across both pages, got %d", len(releases))
+	}
+	prereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get prereleases: %v", err)
+	}
+	if len(prereleases) != 1 || prereleases[0].GetTagName() != "0.2.0-rc1" {
+		t.Errorf("Expected 0.2.0-rc1 to be classified as a prerelease")
+	}
+
+	var release *Release
+	for _, r := range releases {
+		if r.GetTagName() == "0.1.1" {
+			release = r
+		}
+	}
+	if release == nil {
+		t.Fatalf("Expected tag 0.1.1 to be listed")
+	}
+	if err := resolveReleaseDetails(repo, release); err != nil {
+		t.Fatalf("Failed to resolve release details: %v", err)
+	}
+	if release.Variables["RELEASE.DIGEST"] != "sha256:manifest011" {
+		t.Errorf("Unexpected digest %q", release.Variables["RELEASE.DIGEST"])
+	}
+	if release.Variables["RELEASE.CREATED"] != "2023-07-16 12:00:00 +0000 UTC" {
+		t.Errorf("Unexpected created time %q", release.Variables["RELEASE.CREATED"])
+	}
+
+	payload := PayloadEntry{
+		Payload: json.RawMessage(`{"image": "$REPO.URL", "tag": "$RELEASE.TAGNAME", "digest": "$RELEASE.DIGEST"}`),
+	}
+	rendered, err := parsePayload(release, repo, payload)
+	if err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+	expected := fmt.Sprintf(`{"image": "%s/charts/releasebot", "tag": "0.1.1", "digest": "sha256:manifest011"}`, server.Listener.Addr().String())
+	var got, want map[string]interface{}
+	json.Unmarshal(rendered, &got)
+	json.Unmarshal([]byte(expected), &want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected payload %v, got %v", want, got)
+	}
+}
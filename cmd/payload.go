@@ -3,15 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
-
-	"github.com/google/go-github/v55/github"
 )
 
 func replaceVariables(data map[string]interface{}, variables map[string]string) {
@@ -32,9 +29,10 @@ func replaceVariables(data map[string]interface{}, variables map[string]string)
 	}
 }
 
-func parsePayload(release *github.RepositoryRelease, repo RepositoryEntry, payload PayloadEntry) ([]byte, error) {
+// returns the variables available for substitution in payloads (and to payload conditions)
+func payloadVariables(release *Release, repo RepositoryEntry) map[string]string {
 
-	var repo_url string = fmt.Sprintf("git@github.com:%s/%s", repo.Owner, repo.Repo)
+	var repo_url string = repo.sshURL()
 
 	variables := map[string]string{
 		"REPO":                repo.Repo,
@@ -46,7 +44,18 @@ func parsePayload(release *github.RepositoryRelease, repo RepositoryEntry, paylo
 		"AUTHOR.LOGIN":        release.Author.GetLogin(),
 		"AUTHOR.AVATARURL":    release.Author.GetAvatarURL(),
 		"AUTHOR.HTMLURL":      release.Author.GetHTMLURL(),
+		"RELEASE.EVENT":       release.event(),
+	}
+	// source specific variables take precedence
+	for name, value := range release.Variables {
+		variables[name] = value
 	}
+	return variables
+}
+
+func parsePayload(release *Release, repo RepositoryEntry, payload PayloadEntry) ([]byte, error) {
+
+	variables := payloadVariables(release, repo)
 
 	var data map[string]interface{}
 	if err := json.Unmarshal(payload.Payload, &data); err != nil {
@@ -90,9 +99,12 @@ func sendPayload(jsonPayload []byte, url string) error {
 	return nil
 }
 
-func sendAllPayloads(release *github.RepositoryRelease, repo RepositoryEntry, payloadEntries []PayloadEntry) error {
+func sendAllPayloads(release *Release, repo RepositoryEntry, payloadEntries []PayloadEntry) error {
 	for _, payload := range payloadEntries {
-		if repo.Payloads[payload.Name] {
+		if repo.Payloads[payload.Name] && subscribed(payload.Events, release.event()) && release.satisfies(payload.policy(repo)) {
+			if payload.When != nil && !payloadConditionMet(release, repo, payload) {
+				continue
+			}
 			renderedPayload, err := parsePayload(release, repo, payload)
 			if err != nil {
 				return err
@@ -105,3 +117,29 @@ func sendAllPayloads(release *github.RepositoryRelease, repo RepositoryEntry, pa
 	}
 	return nil
 }
+
+// evaluates the condition of the payload for the release, logging why the payload is skipped if it isn't met
+func payloadConditionMet(release *Release, repo RepositoryEntry, payload PayloadEntry) bool {
+	var assets []string
+	for _, asset := range release.Assets {
+		assets = append(assets, asset.GetName())
+	}
+	met, err := payload.When.evaluate(payloadVariables(release, repo), assets)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"payload": payload.Name,
+			"release": release.GetTagName(),
+			"when":    payload.When.String(),
+			"error":   err,
+		}).Error("Failed to evaluate payload condition, skipping payload")
+		return false
+	}
+	if !met {
+		log.WithFields(log.Fields{
+			"payload": payload.Name,
+			"release": release.GetTagName(),
+			"when":    payload.When.String(),
+		}).Info("Skipping payload, condition not met")
+	}
+	return met
+}
@@ -149,7 +149,7 @@ func TestParsePayload(t *testing.T) {
 				}
 			`)
 
-	testCompiledJSONPayload, err := parsePayload(testRelease, testRepoEntry, testPayloadEntry)
+	testCompiledJSONPayload, err := parsePayload(&Release{RepositoryRelease: testRelease}, testRepoEntry, testPayloadEntry)
 	if err != nil {
 		t.Fatalf("Failed to parse payloads: %v", err)
 	}
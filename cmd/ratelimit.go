@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the github rate limits of every api endpoint and token in use
+var githubRateLimits = newRateLimits()
+
+// github rate limits are budgeted per hour
+const rateLimitWindow = time.Hour
+
+// the rate limit budget of one api endpoint and token, shared by all monitors using them
+type rateLimitBucket struct {
+	Endpoint  string    `json:"endpoint"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	// set by secondary rate limits (and exhausted primary ones), no requests are made before then
+	BlockedUntil time.Time `json:"blockedUntil,omitempty"`
+	Monitors     int       `json:"monitors"`
+	// requests counted against the rate limit and polls made, for the average cost of a poll
+	Requests int `json:"requests"`
+	Polls    int `json:"polls"`
+	// the projected requests of all monitors per poll interval and the share of the limit available per interval
+	ProjectedPerInterval int `json:"projectedPerInterval"`
+	BudgetPerInterval    int `json:"budgetPerInterval"`
+}
+
+type rateLimits struct {
+	sync.Mutex
+	buckets map[string]*rateLimitBucket
+}
+
+func newRateLimits() *rateLimits {
+	return &rateLimits{buckets: make(map[string]*rateLimitBucket)}
+}
+
+// the api host of a github repo
+func githubAPIHost(repo RepositoryEntry) string {
+	if repo.Url == "" {
+		return "api.github.com"
+	}
+	parsed, err := url.Parse(repo.Url)
+	if err != nil || parsed.Host == "" {
+		return repo.Url
+	}
+	return parsed.Host
+}
+
+// rate limits apply per token, tokens are only kept hashed. the installation tokens of a github app are replaced
+// every hour but share the rate limit of their installation, so they are keyed by it instead
+func rateLimitKey(repo RepositoryEntry, token string) string {
+	if installation := githubAppInstallation(repo); installation != 0 {
+		return fmt.Sprintf("%s installation %d", githubAPIHost(repo), installation)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return githubAPIHost(repo) + " " + hex.EncodeToString(sum[:4])
+}
+
+func (l *rateLimits) bucket(repo RepositoryEntry, key string) *rateLimitBucket {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{Endpoint: githubAPIHost(repo), Remaining: -1}
+		l.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// returns a transport recording the rate limit headers of the responses in the bucket of the key (see rateLimitKey)
+func (l *rateLimits) transport(repo RepositoryEntry, key string, base http.RoundTripper) http.RoundTripper {
+	return &rateLimitTransport{limits: l, repo: repo, key: key, base: base}
+}
+
+type rateLimitTransport struct {
+	limits *rateLimits
+	repo   RepositoryEntry
+	key    string
+	base   http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// polls are deferred while blocked, this covers requests outside of them (e.g. app installation lookups)
+	if until := t.limits.blockedUntil(t.repo, t.key); time.Now().Before(until) {
+		return nil, fmt.Errorf("github rate limit exceeded, requests are blocked until %s", until.Format(time.RFC3339))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.limits.record(t.repo, t.key, resp)
+	return resp, nil
+}
+
+// returns until when requests counting against the bucket of the key are blocked
+func (l *rateLimits) blockedUntil(repo RepositoryEntry, key string) time.Time {
+	l.Lock()
+	defer l.Unlock()
+	return l.bucket(repo, key).BlockedUntil
+}
+
+// updates the bucket from the rate limit headers of a response
+//
+// graphql and search requests are limited separately, so they only count as requests of a poll and
+// block the token when they hit a secondary limit
+func (l *rateLimits) record(repo RepositoryEntry, key string, resp *http.Response) {
+	l.Lock()
+	defer l.Unlock()
+	bucket := l.bucket(repo, key)
+	if resp.StatusCode != http.StatusNotModified {
+		bucket.Requests++
+	}
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource == "" || resource == "core" {
+		bucket.recordBudget(resp)
+	}
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		bucket.BlockedUntil = time.Now().Add(time.Duration(retryAfter) * time.Second)
+	} else if bucket.Remaining == 0 {
+		bucket.BlockedUntil = bucket.Reset
+	} else {
+		return
+	}
+	log.WithFields(log.Fields{
+		"endpoint":     bucket.Endpoint,
+		"blockedUntil": bucket.BlockedUntil.Format(time.RFC3339),
+	}).Warn("Github rate limit exceeded, deferring polls")
+}
+
+// updates the primary rate limit budget from the headers of a core api response
+func (b *rateLimitBucket) recordBudget(resp *http.Response) {
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		b.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		b.Remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		b.Reset = time.Unix(reset, 0)
+	}
+}
+
+// only github repos count against the github rate limits
+func rateLimited(repo RepositoryEntry) bool {
+	return repo.source() == SourceGithub
+}
+
+// registers a monitor polling the repo, returns a function unregistering it again
+func (l *rateLimits) addMonitor(repo RepositoryEntry) func() {
+	if !rateLimited(repo) {
+		return func() {}
+	}
+	token, err := githubToken(repo)
+	if err != nil {
+		return func() {}
+	}
+	l.Lock()
+	defer l.Unlock()
+	bucket := l.bucket(repo, rateLimitKey(repo, token))
+	bucket.Monitors++
+	return func() {
+		l.Lock()
+		defer l.Unlock()
+		bucket.Monitors--
+	}
+}
+
+// returns how long a monitor of the repo should wait before its next poll
+//
+// this is the interval, unless the rate limit is exhausted (then polls wait for the reset) or all monitors
+// polling every interval would exhaust the remaining requests before the reset (then polls are spread out)
+func (l *rateLimits) nextPoll(repo RepositoryEntry, interval time.Duration) time.Duration {
+	if !rateLimited(repo) {
+		return interval
+	}
+	token, err := githubToken(repo)
+	if err != nil {
+		return interval
+	}
+	l.Lock()
+	defer l.Unlock()
+	bucket := l.bucket(repo, rateLimitKey(repo, token))
+	bucket.Polls++
+	now := time.Now()
+
+	costPerPoll := 1.0
+	if bucket.Polls > 0 && bucket.Requests > 0 {
+		costPerPoll = float64(bucket.Requests) / float64(bucket.Polls)
+	}
+	projected := costPerPoll * float64(bucket.Monitors)
+	bucket.ProjectedPerInterval = int(projected + 0.5)
+	bucket.BudgetPerInterval = int(float64(bucket.Limit) * interval.Seconds() / rateLimitWindow.Seconds())
+	fields := log.Fields{
+		"endpoint":             bucket.Endpoint,
+		"remaining":            bucket.Remaining,
+		"reset":                bucket.Reset.Format(time.RFC3339),
+		"projectedPerInterval": bucket.ProjectedPerInterval,
+		"budgetPerInterval":    bucket.BudgetPerInterval,
+	}
+
+	if bucket.BlockedUntil.After(now) {
+		return bucket.BlockedUntil.Sub(now)
+	}
+	if bucket.Remaining < 0 || !bucket.Reset.After(now) {
+		// nothing known about the budget (yet) or it was already reset
+		return interval
+	}
+	untilReset := bucket.Reset.Sub(now)
+	if bucket.Remaining == 0 {
+		log.WithFields(fields).Warn("Github rate limit exhausted, deferring poll until reset")
+		return untilReset
+	}
+	// each monitor has to make do with its share of the remaining requests until the reset
+	pollsUntilReset := float64(bucket.Remaining) / projected
+	if pollsUntilReset*interval.Seconds() >= untilReset.Seconds() {
+		log.WithFields(fields).Debug("Github rate limit budget")
+		return interval
+	}
+	spread := time.Duration(untilReset.Seconds() / pollsUntilReset * float64(time.Second))
+	fields["nextPoll"] = spread.String()
+	log.WithFields(fields).Warn("Projected github api usage exceeds the remaining rate limit, spreading polls")
+	return spread
+}
+
+// the current rate limit buckets, sorted by endpoint
+func (l *rateLimits) snapshot() []rateLimitBucket {
+	l.Lock()
+	defer l.Unlock()
+	var buckets []rateLimitBucket
+	for _, bucket := range l.buckets {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Endpoint < buckets[j].Endpoint
+	})
+	return buckets
+}
+
+// sources env var METRICS_ADDR, blocks serving the current github rate limit budgets on /ratelimits of the given address
+func serveMetrics(addr string) error {
+	log.WithFields(log.Fields{
+		"addr": addr,
+	}).Info("Serving rate limits")
+	mux := http.NewServeMux()
+	mux.Handle("/ratelimits", githubRateLimits)
+	return http.ListenAndServe(addr, mux)
+}
+
+// serves the current rate limit buckets as json
+func (l *rateLimits) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.snapshot()); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode rate limits: %v", err), http.StatusInternalServerError)
+	}
+}
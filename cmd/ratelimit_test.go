@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	reset := time.Now().Add(30 * time.Minute).Unix()
+	secondary := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset))
+		w.Header().Set("X-RateLimit-Resource", "core")
+		if secondary {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit."}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer ts.Close()
+
+	defaultLimits := githubRateLimits
+	defer func() { githubRateLimits = defaultLimits }()
+	githubRateLimits = newRateLimits()
+
+	repo := RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "rancher"}
+	removeMonitor := githubRateLimits.addMonitor(repo)
+	if _, err := getAllGithubReleases(repo); err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	buckets := githubRateLimits.snapshot()
+	if len(buckets) != 1 || buckets[0].Remaining != 4321 || buckets[0].Limit != 5000 || buckets[0].Reset.Unix() != reset {
+		t.Fatalf("Expected rate limit headers to be recorded, got %+v", buckets)
+	}
+	if next := githubRateLimits.nextPoll(repo, 5*time.Minute); next != 5*time.Minute {
+		t.Errorf("Expected polls within budget to keep the interval, got %v", next)
+	}
+
+	secondary = true
+	if _, err := getAllGithubReleases(repo); err == nil {
+		t.Fatalf("Expected secondary rate limit to fail the request")
+	}
+	if next := githubRateLimits.nextPoll(repo, 5*time.Minute); next < 119*time.Second || next > 120*time.Second {
+		t.Errorf("Expected poll to be deferred by the retry-after header, got %v", next)
+	}
+
+	rec := httptest.NewRecorder()
+	githubRateLimits.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ratelimits", nil))
+	var exposed []rateLimitBucket
+	if err := json.NewDecoder(rec.Body).Decode(&exposed); err != nil || len(exposed) != 1 || exposed[0].Monitors != 1 {
+		t.Errorf("Unexpected exposed rate limits %v (%v)", exposed, err)
+	}
+	removeMonitor()
+	if githubRateLimits.snapshot()[0].Monitors != 0 {
+		t.Errorf("Expected monitor to be unregistered")
+	}
+}
+
+func TestRateLimitNextPoll(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	limits := newRateLimits()
+	repo := RepositoryEntry{Owner: "rancher", Repo: "rancher"}
+	bucket := limits.bucket(repo, rateLimitKey(repo, ""))
+	bucket.Limit = 60
+	bucket.Remaining = 10
+	bucket.Reset = time.Now().Add(time.Hour)
+	bucket.Monitors = 4
+	// the next poll makes it 2 requests per poll
+	bucket.Requests = 2
+	bucket.Polls = 0
+
+	// 8 requests per interval leave just 1 interval worth of polls, spread over the hour until the reset
+	next := limits.nextPoll(repo, 5*time.Minute)
+	if next < 47*time.Minute || next > 48*time.Minute {
+		t.Errorf("Expected polls to be spread until the reset, got %v", next)
+	}
+	if bucket.ProjectedPerInterval != 8 || bucket.BudgetPerInterval != 5 {
+		t.Errorf("Unexpected projected budget %d of %d", bucket.ProjectedPerInterval, bucket.BudgetPerInterval)
+	}
+
+	bucket.Remaining = 0
+	if next := limits.nextPoll(repo, 5*time.Minute); next < 59*time.Minute {
+		t.Errorf("Expected exhausted rate limit to defer polls until the reset, got %v", next)
+	}
+
+	bucket.Reset = time.Now().Add(-time.Minute)
+	if next := limits.nextPoll(repo, 5*time.Minute); next != 5*time.Minute {
+		t.Errorf("Expected a reset rate limit to keep the interval, got %v", next)
+	}
+
+	if next := limits.nextPoll(RepositoryEntry{Source: SourceGitlab, Owner: "gitlab-org", Repo: "gitlab"}, time.Minute); next != time.Minute {
+		t.Errorf("Expected repos of other sources to not be rate limited, got %v", next)
+	}
+}
+
+func TestRateLimitGithubAppTokenRotation(t *testing.T) {
+	writeTestAppKey(t)
+	tokenRequests := 0
+	reset := time.Now().Add(time.Hour).Unix()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/orgs/rancher/installation":
+			fmt.Fprint(w, `{"id": 42}`)
+		case "/api/v3/app/installations/42/access_tokens":
+			tokenRequests++
+			// the tokens expire right away, so every poll rotates them
+			fmt.Fprintf(w, `{"token": "ghs_%d", "expires_at": "%s"}`, tokenRequests, time.Now().Add(time.Minute).Format(time.RFC3339))
+		case "/api/v3/repos/rancher/rancher/releases":
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", "1")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset))
+			fmt.Fprint(w, `[]`)
+		case "/api/v3/repos/rancher/rancher/git/matching-refs/tags":
+			fmt.Fprint(w, `[]`)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	app, err := loadGithubApp()
+	if err != nil {
+		t.Fatalf("Failed to load github app: %v", err)
+	}
+	githubAppOnce.Do(func() {})
+	githubAppAuth = app
+	defer func() { githubAppAuth = nil }()
+	defaultLimits := githubRateLimits
+	defer func() { githubRateLimits = defaultLimits }()
+	githubRateLimits = newRateLimits()
+
+	repo := RepositoryEntry{Url: ts.URL, Owner: "rancher", Repo: "rancher"}
+	removeMonitor := githubRateLimits.addMonitor(repo)
+	defer removeMonitor()
+	if _, err := getAllGithubReleases(repo); err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if tokenRequests < 2 {
+		t.Fatalf("Expected the installation token to be rotated, got %d tokens", tokenRequests)
+	}
+	// the monitor registered with the first token still counts against the budget polled with the later ones
+	if next := githubRateLimits.nextPoll(repo, 5*time.Minute); next <= 5*time.Minute {
+		t.Errorf("Expected polls to be spread after the token rotated, got %v", next)
+	}
+	// the installation and the app itself
+	if buckets := githubRateLimits.snapshot(); len(buckets) != 2 {
+		t.Errorf("Expected rotated tokens to share the bucket of their installation, got %+v", buckets)
+	}
+}
+
+func TestRateLimitGraphQLSecondaryLimit(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_graphql")
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "17")
+		w.Header().Set("X-RateLimit-Resource", "graphql")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit."}`)
+	}))
+	defer ts.Close()
+
+	defaultLimits := githubRateLimits
+	defer func() { githubRateLimits = defaultLimits }()
+	githubRateLimits = newRateLimits()
+
+	repo := RepositoryEntry{Url: ts.URL + "/api/v3/", Owner: "rancher", Repo: "rancher"}
+	if _, errors := fetchGraphQLReleases(repo, "ghp_graphql", []RepositoryEntry{repo}); errors[graphqlRepoKey(repo)] == nil {
+		t.Fatalf("Expected the secondary rate limit to fail the query")
+	}
+	buckets := githubRateLimits.snapshot()
+	if len(buckets) != 1 || buckets[0].Requests != 1 || buckets[0].Remaining != -1 {
+		t.Fatalf("Expected the graphql request to be counted without touching the core budget, got %+v", buckets)
+	}
+	if next := githubRateLimits.nextPoll(repo, 5*time.Minute); next < 59*time.Second || next > 60*time.Second {
+		t.Errorf("Expected poll to be deferred by the retry-after header, got %v", next)
+	}
+	if _, errors := fetchGraphQLReleases(repo, "ghp_graphql", []RepositoryEntry{repo}); errors[graphqlRepoKey(repo)] == nil || requests != 1 {
+		t.Errorf("Expected queries to be blocked until the retry-after passed, got %d requests", requests)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/google/go-github/v55/github"
+)
+
+// a release as handled by releasebot
+//
+// every source is mapped onto the github release representation, anything source specific that has no
+// place in it (e.g. image digests) is carried as additional payload variables
+type Release struct {
+	*github.RepositoryRelease
+	Variables map[string]string `json:"-"`
+	// what happened to the release, empty for a newly published one
+	Event string `json:"-"`
+	// the newest policies the release satisfies, nil if they weren't evaluated (it satisfies every policy)
+	Newest map[string]bool `json:"-"`
+}
+
+// events actions are run for
+const (
+	EventPublished      = "published"
+	EventAssetsTimedOut = "assets_timed_out"
+	EventEdited         = "edited"
+	EventPromoted       = "promoted"
+	EventRetagged       = "retagged"
+	EventDeleted        = "deleted"
+)
+
+// the events payloads and slack notifications are sent for unless configured otherwise
+var defaultEvents = []string{EventPublished, EventAssetsTimedOut}
+
+// checks whether the event is among the subscribed events (the default events if none are)
+func subscribed(events []string, event string) bool {
+	if len(events) == 0 {
+		events = defaultEvents
+	}
+	for _, subscribed := range events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// returns what happened to the release
+func (r *Release) event() string {
+	if r.Event == "" {
+		return EventPublished
+	}
+	return r.Event
+}
+
+// returns the version of the release, $RELEASE.TAGNAME for sources whose tag name isn't the version (e.g. channels)
+func (r *Release) version() string {
+	if version, ok := r.Variables["RELEASE.TAGNAME"]; ok {
+		return version
+	}
+	return r.GetTagName()
+}
+
+// wraps github releases (or releases already mapped onto the github representation)
+func wrapReleases(releases []*github.RepositoryRelease) []*Release {
+	var wrapped []*Release
+	for _, release := range releases {
+		wrapped = append(wrapped, &Release{RepositoryRelease: release})
+	}
+	return wrapped
+}
@@ -2,13 +2,13 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"time"
-
-	"github.com/google/go-github/v55/github"
 )
 
 var slackurl string = "https://slack.com/api"
@@ -17,62 +17,17 @@ var token = os.Getenv("slack_token")
 var releasesChannel = os.Getenv("releases_channel")
 var prereleasesChannel = os.Getenv("prereleases_channel")
 
-func slacknotif(release *github.RepositoryRelease, owner string, repo string) error {
+func slacknotif(release *Release, repo RepositoryEntry) error {
 
 	if token == "" {
 		log.Fatal("Missing slack token")
 	}
 
-	publishedDate := release.GetPublishedAt().Time
-	releaseType := "Release"
-	channel := releasesChannel
-	if release.GetPrerelease() {
-		releaseType = "Prerelease"
-		channel = prereleasesChannel
+	jsonData, err := slackMessage(release, repo)
+	if err != nil {
+		return err
 	}
 
-	var jsonData = []byte(`{
-		"channel": "` + channel + `",
-		"blocks": [
-		{
-			"type": "header",
-			"text": {
-				"type": "plain_text",
-				"text": "` + owner + `/` + repo + ` -  New ` + releaseType + `!"
-			}
-		},
-		{
-			"type": "divider"
-		},
-		{
-			"type": "section",
-			"text": {
-				"type": "mrkdwn",
-				"text": "` + release.GetName() + ` is now available!\n\n<https://github.com/` + owner + `/` + repo + `/releases/tag/` + release.GetTagName() + `>"
-			},
-			"accessory": {
-				"type": "image",
-				"image_url": "https://github.com/` + owner + `.png",
-				"alt_text": "repo icon"
-			}
-		},
-		{
-			"type": "context",
-			"elements": [
-			{
-				"type": "image",
-				"image_url": "` + release.Author.GetAvatarURL() + `",
-				"alt_text": "author profile img"
-			},
-			{
-				"type": "mrkdwn",
-				"text": "Authored by: ` + release.Author.GetLogin() + ` on ` + publishedDate.Format("Jan 2, 2006") + ` at ` + publishedDate.In(time.UTC).Format("3:04pm MST") + `"
-			}
-			]
-		}
-		]
-	}`)
-
 	req, err := http.NewRequest("POST", slackurl+"/chat.postMessage", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
@@ -91,3 +46,81 @@ func slacknotif(release *github.RepositoryRelease, owner string, repo string) er
 	}
 	return nil
 }
+
+// builds the chat.postMessage request announcing the release
+//
+// names and variables come from the release sources (e.g. feed titles), so the message is marshalled rather than pasted together
+func slackMessage(release *Release, repo RepositoryEntry) ([]byte, error) {
+	releaseURL := fmt.Sprintf("%s/%s/%s/releases/tag/%s", repo.webURL(), repo.Owner, repo.Repo, release.GetTagName())
+	iconURL := fmt.Sprintf("%s/%s.png", repo.webURL(), repo.Owner)
+	if repo.source() != SourceGithub {
+		// other forges have neither owner avatars at a predictable path nor necessarily the github release url layout
+		releaseURL = release.GetHTMLURL()
+		iconURL = release.Author.GetAvatarURL()
+	}
+
+	publishedDate := release.GetPublishedAt().Time
+	releaseType := "Release"
+	channel := releasesChannel
+	if release.GetPrerelease() {
+		releaseType = "Prerelease"
+		channel = prereleasesChannel
+	}
+
+	headline := `New ` + releaseType + `!`
+	text := release.GetName() + ` is now available!`
+	switch release.event() {
+	case EventAssetsTimedOut:
+		headline = releaseType + ` Assets Missing!`
+		text = release.GetName() + ` was published, but assets matching ` + release.Variables["RELEASE.MISSINGASSETS"] + ` did not appear in time!`
+	case EventPromoted:
+		headline = `Prerelease Promoted!`
+		text = release.GetName() + ` is now a full release!`
+	case EventRetagged:
+		headline = releaseType + ` Retagged!`
+		text = `The tag of ` + release.GetName() + ` was moved from ` + release.Variables["RELEASE.PREVIOUSCOMMIT"] + ` to ` + release.Variables["RELEASE.COMMIT"] + `!`
+	case EventDeleted:
+		headline = releaseType + ` Deleted!`
+		text = release.GetName() + ` was deleted!`
+	case EventEdited:
+		headline = releaseType + ` Edited!`
+		text = release.GetName() + ` was edited (` + release.Variables["RELEASE.CHANGES"] + `)!`
+	}
+
+	// sources without release pages or authors (e.g. oci registries) leave out the corresponding parts of the message
+	if releaseURL != "" {
+		text += "\n\n<" + releaseURL + ">"
+	}
+	section := map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+	if iconURL != "" {
+		section["accessory"] = map[string]string{"type": "image", "image_url": iconURL, "alt_text": "repo icon"}
+	}
+	var elements []interface{}
+	if release.Author.GetAvatarURL() != "" {
+		elements = append(elements, map[string]string{"type": "image", "image_url": release.Author.GetAvatarURL(), "alt_text": "author profile img"})
+	}
+	context := "Published"
+	if release.Author.GetLogin() != "" {
+		context = "Authored by: " + release.Author.GetLogin()
+	}
+	elements = append(elements, map[string]string{
+		"type": "mrkdwn",
+		"text": context + ` on ` + publishedDate.Format("Jan 2, 2006") + ` at ` + publishedDate.In(time.UTC).Format("3:04pm MST"),
+	})
+
+	return json.Marshal(map[string]interface{}{
+		"channel": channel,
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": repo.fullName() + ` -  ` + headline},
+			},
+			map[string]string{"type": "divider"},
+			section,
+			map[string]interface{}{"type": "context", "elements": elements},
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestSlackMessageEscapesReleaseText(t *testing.T) {
+	name := "Release \"v1.0.0\" of C:\\dist\nwith a second line"
+	release := &Release{
+		RepositoryRelease: &github.RepositoryRelease{TagName: github.String("v1.0.0"), Name: github.String(name)},
+		Variables:         map[string]string{"RELEASE.CHANGES": "body \"quoted\"\n"},
+		Event:             EventEdited,
+	}
+	repo := RepositoryEntry{Source: SourceFeed, Url: "https://example.com/feed.xml"}
+	data, err := slackMessage(release, repo)
+	if err != nil {
+		t.Fatalf("Failed to build slack message: %v", err)
+	}
+	var message struct {
+		Blocks []struct {
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatalf("Expected a valid json message, got %v: %s", err, data)
+	}
+	expected := name + " was edited (body \"quoted\"\n)!"
+	if len(message.Blocks) != 4 || message.Blocks[2].Text.Text != expected {
+		t.Errorf("Expected the section to carry %q, got %s", expected, data)
+	}
+}
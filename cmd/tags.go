@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// supported values for the mode field of a RepositoryEntry
+const (
+	ModeReleases = "releases"
+	ModeTags     = "tags"
+)
+
+// matches semver-ish versions carrying a prerelease identifier, e.g. v1.2.3-rc1 or v1.28.2-rc1+k3s1
+var prereleaseTagRegex = regexp.MustCompile(`^v?\d+(\.\d+)*-[0-9A-Za-z.-]+(\+[0-9A-Za-z.-]+)?$`)
+
+// annotated tag objects are immutable so lookups are cached by object sha across polls
+var annotatedTagCache = struct {
+	sync.Mutex
+	tags map[string]*github.Tag
+}{tags: make(map[string]*github.Tag)}
+
+// reports whether a tag name denotes a prerelease
+func isPrereleaseTag(tagName string) bool {
+	return prereleaseTagRegex.MatchString(tagName)
+}
+
+// reports whether the release is a prerelease, either flagged as one or, when the repo classifies prereleases,
+// tagged like one (a semver prerelease identifier or a match of the repo's prerelease patterns)
+func classifiedPrerelease(repo RepositoryEntry, release *Release) bool {
+	if release.GetPrerelease() {
+		return true
+	}
+	if repo.PrereleasePatterns.match(release.version()) != nil {
+		return true
+	}
+	return repo.ClassifyPrereleases && isPrereleaseTag(release.version())
+}
+
+// flags the releases tagged like prereleases as such, for upstreams that don't (reliably) flag their prereleases
+//
+// listings may be shared by repo entries classifying differently, so flagged releases are copies
+func classifyPrereleases(repo RepositoryEntry, releases []*Release) []*Release {
+	for _, release := range releases {
+		if !release.GetPrerelease() && classifiedPrerelease(repo, release) {
+			classified := *release.RepositoryRelease
+			classified.Prerelease = github.Bool(true)
+			release.RepositoryRelease = &classified
+		}
+	}
+	return releases
+}
+
+// fetches all tags for a github repo and synthesizes a release for each of them
+//
+// when tag annotations are enabled the tagger and message of annotated tags populate the author, publish date and body
+func getAllGithubTags(repo RepositoryEntry) ([]*github.RepositoryRelease, error) {
+	client, err := newGithubClient(repo)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	var allTags []*github.RepositoryTag
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		tags, resp, err := client.Repositories.ListTags(ctx, repo.Owner, repo.Repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		allTags = append(allTags, tags...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	annotations := make(map[string]*github.Tag)
+	if repo.TagAnnotations {
+		annotations, err = getTagAnnotations(ctx, client, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var releases []*github.RepositoryRelease
+	for _, tag := range allTags {
+		releases = append(releases, tagToRelease(repo, tag, annotations[tag.GetName()]))
+	}
+	return releases, nil
+}
+
+// fetches the annotated tag objects of a repo keyed by tag name (lightweight tags are omitted)
+func getTagAnnotations(ctx context.Context, client *github.Client, repo RepositoryEntry) (map[string]*github.Tag, error) {
+	refs, err := listTagRefs(ctx, client, repo)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(map[string]*github.Tag)
+	for _, ref := range refs {
+		if ref.GetObject().GetType() != "tag" {
+			continue
+		}
+		sha := ref.GetObject().GetSHA()
+		annotatedTagCache.Lock()
+		tag, ok := annotatedTagCache.tags[sha]
+		annotatedTagCache.Unlock()
+		if !ok {
+			tag, _, err = client.Git.GetTag(ctx, repo.Owner, repo.Repo, sha)
+			if err != nil {
+				return nil, err
+			}
+			annotatedTagCache.Lock()
+			annotatedTagCache.tags[sha] = tag
+			annotatedTagCache.Unlock()
+		}
+		annotations[strings.TrimPrefix(ref.GetRef(), "refs/tags/")] = tag
+	}
+	return annotations, nil
+}
+
+// fetches the object every tag of a repo points at keyed by tag name, the commit of a lightweight tag and the tag
+// object of an annotated one (which is replaced as well when the tag moves, so it isn't peeled)
+func getGithubTagObjects(ctx context.Context, client *github.Client, repo RepositoryEntry) (map[string]string, error) {
+	refs, err := listTagRefs(ctx, client, repo)
+	if err != nil {
+		return nil, err
+	}
+	objects := make(map[string]string)
+	for _, ref := range refs {
+		objects[strings.TrimPrefix(ref.GetRef(), "refs/tags/")] = ref.GetObject().GetSHA()
+	}
+	return objects, nil
+}
+
+// pages through the tag refs of a repo
+func listTagRefs(ctx context.Context, client *github.Client, repo RepositoryEntry) ([]*github.Reference, error) {
+	var allRefs []*github.Reference
+	opt := &github.ReferenceListOptions{Ref: "tags", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		refs, resp, err := client.Git.ListMatchingRefs(ctx, repo.Owner, repo.Repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		allRefs = append(allRefs, refs...)
+		if resp.NextPage == 0 {
+			return allRefs, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// synthesizes a release from a tag, classifying it as a prerelease based on its name
+func tagToRelease(repo RepositoryEntry, tag *github.RepositoryTag, annotation *github.Tag) *github.RepositoryRelease {
+	release := &github.RepositoryRelease{
+		TagName:         tag.Name,
+		Name:            tag.Name,
+		TargetCommitish: tag.GetCommit().SHA,
+		Draft:           github.Bool(false),
+		Prerelease:      github.Bool(isPrereleaseTag(tag.GetName())),
+		HTMLURL:         github.String(fmt.Sprintf("%s/%s/%s/releases/tag/%s", repo.webURL(), repo.Owner, repo.Repo, tag.GetName())),
+		TarballURL:      tag.TarballURL,
+		ZipballURL:      tag.ZipballURL,
+		// tags carry no github user so the repo owner stands in as the author
+		Author: &github.User{
+			Login:     github.String(repo.Owner),
+			AvatarURL: github.String(fmt.Sprintf("%s/%s.png", repo.webURL(), repo.Owner)),
+			HTMLURL:   github.String(fmt.Sprintf("%s/%s", repo.webURL(), repo.Owner)),
+		},
+	}
+	if annotation != nil {
+		release.Body = annotation.Message
+		if tagger := annotation.GetTagger(); tagger != nil {
+			release.PublishedAt = tagger.Date
+			release.Author.Login = tagger.Name
+			release.Author.Email = tagger.Email
+		}
+	}
+	return release
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v55/github"
+)
+
+func TestIsPrereleaseTag(t *testing.T) {
+	tests := map[string]bool{
+		"v1.2.3":            false,
+		"1.2.3":             false,
+		"v1.28.2+k3s1":      false,
+		"v1.2.3-rc1":        true,
+		"v2.8.0-alpha.1":    true,
+		"v1.28.2-rc1+k3s1":  true,
+		"release-2.0":       false,
+		"v1.2.3-hotfix-abc": true,
+	}
+	for tag, expected := range tests {
+		if isPrereleaseTag(tag) != expected {
+			t.Errorf("Expected isPrereleaseTag(%q) to be %t", tag, expected)
+		}
+	}
+}
+
+func TestClassifyPrereleases(t *testing.T) {
+	release := func(tag string, prerelease bool) *Release {
+		return &Release{RepositoryRelease: &github.RepositoryRelease{TagName: github.String(tag), Prerelease: github.Bool(prerelease)}}
+	}
+	listing := []*Release{release("v2.8.0", false), release("v2.8.1-rc1", false), release("v2.8.1-hotfix-test", false), release("nightly-2023", false), release("v2.9.0", true)}
+	var repo RepositoryEntry
+	if err := json.Unmarshal([]byte(`{"classifyPrereleases": true, "prereleasePatterns": ["^nightly-"]}`), &repo); err != nil {
+		t.Fatalf("Failed to parse classifier: %v", err)
+	}
+	shared := listing[1].RepositoryRelease
+	classified := classifyPrereleases(repo, append([]*Release(nil), listing...))
+	expected := []bool{false, true, true, true, true}
+	for i, release := range classified {
+		if release.GetPrerelease() != expected[i] {
+			t.Errorf("Expected %s to be a prerelease: %t", release.GetTagName(), expected[i])
+		}
+	}
+	if shared.GetPrerelease() {
+		t.Errorf("Expected the listed release to be copied instead of flagged")
+	}
+	if len(filterPrereleases(classified)) != 1 || len(filterReleases(classified)) != 4 {
+		t.Errorf("Expected classified prereleases to be filtered as prereleases")
+	}
+	if unclassified := classifyPrereleases(RepositoryEntry{}, []*Release{release("v2.8.1-rc1", false)}); unclassified[0].GetPrerelease() {
+		t.Errorf("Expected tags to only be classified when enabled")
+	}
+}
+
+func TestGetAllGithubTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/repo/tags":
+			fmt.Fprint(w, `[
+				{"name": "v1.1.0-rc1", "commit": {"sha": "bbb"}, "tarball_url": "https://example.com/v1.1.0-rc1.tar.gz"},
+				{"name": "v1.0.0", "commit": {"sha": "aaa"}, "tarball_url": "https://example.com/v1.0.0.tar.gz"}
+			]`)
+		case "/api/v3/repos/owner/repo/git/matching-refs/tags":
+			fmt.Fprint(w, `[
+				{"ref": "refs/tags/v1.0.0", "object": {"type": "tag", "sha": "tag-aaa"}},
+				{"ref": "refs/tags/v1.1.0-rc1", "object": {"type": "commit", "sha": "bbb"}}
+			]`)
+		case "/api/v3/repos/owner/repo/git/tags/tag-aaa":
+			fmt.Fprint(w, `{
+				"tag": "v1.0.0",
+				"sha": "tag-aaa",
+				"message": "First release",
+				"tagger": {"name": "Jane Doe", "email": "jane@example.com", "date": "2023-01-15T00:00:00Z"},
+				"object": {"type": "commit", "sha": "aaa"}
+			}`)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	repo := RepositoryEntry{
+		Url:            ts.URL,
+		Owner:          "owner",
+		Repo:           "repo",
+		Mode:           ModeTags,
+		TagAnnotations: true,
+	}
+
+	releases, err := getLatestReleases(repo, false, -1)
+	if err != nil {
+		t.Fatalf("Failed to get tags: %v", err)
+	}
+	if len(releases) != 1 {
+		t.Fatalf("Expected 1 release, got %d", len(releases))
+	}
+	release := releases[0]
+	if release.GetTagName() != "v1.0.0" || release.GetTargetCommitish() != "aaa" {
+		t.Errorf("Unexpected release %s at %s", release.GetTagName(), release.GetTargetCommitish())
+	}
+	if release.GetBody() != "First release" || release.Author.GetLogin() != "Jane Doe" {
+		t.Errorf("Expected annotation to populate body and author, got %q by %q", release.GetBody(), release.Author.GetLogin())
+	}
+	if release.PublishedAt == nil {
+		t.Errorf("Expected tagger date to populate publish date")
+	}
+
+	prereleases, err := getLatestReleases(repo, true, -1)
+	if err != nil {
+		t.Fatalf("Failed to get tags: %v", err)
+	}
+	if len(prereleases) != 1 || prereleases[0].GetTagName() != "v1.1.0-rc1" {
+		t.Errorf("Expected v1.1.0-rc1 to be classified as a prerelease")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// number of delivery ids remembered to drop redelivered webhooks
+const webhookDeliveryHistorySize = 1000
+
+// a bounded set of recently seen webhook delivery ids, the oldest ones are forgotten first
+type deliverySet struct {
+	sync.Mutex
+	seen  map[string]bool
+	order []string
+	size  int
+}
+
+func newDeliverySet(size int) *deliverySet {
+	return &deliverySet{
+		seen: make(map[string]bool),
+		size: size,
+	}
+}
+
+// checks whether the delivery id was already seen
+func (d *deliverySet) contains(id string) bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.seen[id]
+}
+
+// records a delivery id, returns false if it was already seen
+func (d *deliverySet) add(id string) bool {
+	d.Lock()
+	defer d.Unlock()
+	if d.seen[id] {
+		return false
+	}
+	d.seen[id] = true
+	d.order = append(d.order, id)
+	if len(d.order) > d.size {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	return true
+}
+
+// receives github release webhooks and dispatches them to the actions of the matching repo entries
+type webhookReceiver struct {
+	secret     []byte
+	repos      []RepositoryEntry
+	deliveries *deliverySet
+	dispatch   func(repo RepositoryEntry, release *Release)
+}
+
+func newWebhookReceiver(secret string, repos []RepositoryEntry, payloads []PayloadEntry) *webhookReceiver {
+	return &webhookReceiver{
+		secret:     []byte(secret),
+		repos:      repos,
+		deliveries: newDeliverySet(webhookDeliveryHistorySize),
+		dispatch: func(repo RepositoryEntry, release *Release) {
+			dispatchWebhookRelease(repo, release, payloads)
+		},
+	}
+}
+
+// sources env vars WEBHOOK_ADDR and WEBHOOK_SECRET, blocks serving webhooks on the given address
+func serveWebhooks(addr string, repos []RepositoryEntry, payloads []PayloadEntry) error {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		return fmt.Errorf("WEBHOOK_SECRET must be set when WEBHOOK_ADDR is")
+	}
+	log.WithFields(log.Fields{
+		"addr": addr,
+	}).Info("Listening for github webhooks")
+	return http.ListenAndServe(addr, newWebhookReceiver(secret, repos, payloads))
+}
+
+func (h *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload []byte
+	err := fmt.Errorf("missing %s header", github.SHA256SignatureHeader)
+	// ValidatePayload falls back to the sha1 signature, which isn't accepted
+	if r.Header.Get(github.SHA256SignatureHeader) != "" {
+		payload, err = github.ValidatePayload(r, h.secret)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"remoteAddr": r.RemoteAddr,
+			"error":      err,
+		}).Warn("Rejected webhook delivery")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	eventType := github.WebHookType(r)
+	deliveryID := github.DeliveryID(r)
+	if deliveryID != "" && h.deliveries.contains(deliveryID) {
+		log.WithFields(log.Fields{
+			"deliveryID": deliveryID,
+		}).Debug("Ignoring redelivered webhook")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// deliveries are only remembered once handled, so a redelivery of one that failed is processed again
+	handled := func(status int) {
+		if deliveryID != "" {
+			h.deliveries.add(deliveryID)
+		}
+		w.WriteHeader(status)
+	}
+	if eventType == "ping" {
+		handled(http.StatusOK)
+		return
+	}
+	if eventType != "release" {
+		handled(http.StatusNoContent)
+		return
+	}
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	releaseEvent := event.(*github.ReleaseEvent)
+	if releaseEvent.GetAction() != "published" || releaseEvent.GetRelease().GetDraft() {
+		handled(http.StatusNoContent)
+		return
+	}
+	repos := h.matchingRepos(releaseEvent.GetRepo())
+	// github gives up on deliveries after 10 seconds, so actions run after responding
+	handled(http.StatusAccepted)
+	for _, repo := range repos {
+		release := classifyPrereleases(repo, []*Release{{RepositoryRelease: releaseEvent.GetRelease()}})[0]
+		if release.GetPrerelease() && !repo.Prereleases {
+			continue
+		}
+		go h.dispatch(repo, release)
+	}
+}
+
+// returns the repo entries monitoring releases of the webhook's repo, discovery entries are expanded if the repo passes their filters
+func (h *webhookReceiver) matchingRepos(repo *github.Repository) []RepositoryEntry {
+	var matching []RepositoryEntry
+	for _, entry := range h.repos {
+		if entry.source() != SourceGithub || entry.Mode == ModeTags {
+			continue
+		}
+		if !strings.EqualFold(entry.Owner, repo.GetOwner().GetLogin()) {
+			continue
+		}
+		if entry.Discover != nil {
+			if discoveryMatches(entry, repo) {
+				matching = append(matching, discoveredRepo(entry, repo))
+			}
+			continue
+		}
+		if strings.EqualFold(entry.Repo, repo.GetName()) {
+			matching = append(matching, entry)
+		}
+	}
+	return matching
+}
+
+// runs the actions of a release delivered by webhook unless it was already seen by a monitor (or an earlier delivery)
+func dispatchWebhookRelease(repo RepositoryEntry, release *Release, payloads []PayloadEntry) {
+	repoName := repo.fullName()
+	if len(getReleaseHistory(repo).checkForNewReleases([]*Release{release})) == 0 {
+		log.WithFields(log.Fields{
+			"repoName": repoName,
+			"release":  release.GetTagName(),
+		}).Info("Webhook release already known")
+		return
+	}
+	if len(filterIgnored(repo, []*Release{release})) == 0 {
+		recordIgnoredReleases(repo, []*Release{release}, nil)
+		return
+	}
+	markNewestReleases(repo, []*Release{release}, getReleaseHistory(repo).knownReleases(repo, []*Release{release}))
+	log.WithFields(log.Fields{
+		"repoName": repoName,
+		"release":  release.GetTagName(),
+	}).Info("Received new release by webhook")
+	if err := resolveReleaseDetails(repo, release); err != nil {
+		log.WithFields(log.Fields{
+			"repoName": repoName,
+			"release":  release.GetTagName(),
+			"error":    err,
+		}).Warn("Failed to resolve release details")
+	}
+	// pending releases are picked up by the monitors once their assets are complete
+	if missing := missingAssets(repo, release); len(missing) > 0 {
+		log.WithFields(log.Fields{
+			"repoName":      repoName,
+			"release":       release.GetTagName(),
+			"missingAssets": strings.Join(missing, ", "),
+		}).Info("Waiting for release assets")
+		getReleaseHistory(repo).addPending(release)
+		return
+	}
+	runReleaseActions(repo, release, payloads, log.Fields{"repoName": repoName})
+}
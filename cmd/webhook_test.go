@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+const testReleaseWebhook = `{
+	"action": "published",
+	"release": {"tag_name": "v2.8.0", "prerelease": false, "html_url": "https://github.com/rancher/rancher/releases/tag/v2.8.0"},
+	"repository": {"name": "Rancher", "owner": {"login": "rancher"}, "topics": ["kubernetes"]}
+}`
+
+func sendTestWebhook(h http.Handler, secret, event, delivery, body string) int {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	repos := []RepositoryEntry{
+		{Owner: "rancher", Repo: "rancher"},
+		{Owner: "rancher", Repo: "rke2"},
+		{Owner: "rancher", Discover: &DiscoveryEntry{Topic: "kubernetes"}},
+		{Owner: "rancher", Repo: "rancher", Mode: ModeTags},
+	}
+	receiver := newWebhookReceiver("s3cret", repos, nil)
+	dispatched := make(chan RepositoryEntry, 10)
+	receiver.dispatch = func(repo RepositoryEntry, release *Release) {
+		if release.GetTagName() != "v2.8.0" {
+			t.Errorf("Expected release v2.8.0 to be dispatched, got %s", release.GetTagName())
+		}
+		dispatched <- repo
+	}
+
+	if code := sendTestWebhook(receiver, "wrong", "release", "1", testReleaseWebhook); code != http.StatusUnauthorized {
+		t.Errorf("Expected invalid signature to be rejected, got %d", code)
+	}
+	if code := sendTestWebhook(receiver, "s3cret", "ping", "2", `{"zen": "Keep it logically awesome."}`); code != http.StatusOK {
+		t.Errorf("Expected ping to be acknowledged, got %d", code)
+	}
+	if code := sendTestWebhook(receiver, "s3cret", "release", "3", testReleaseWebhook); code != http.StatusAccepted {
+		t.Errorf("Expected release to be accepted, got %d", code)
+	}
+	var got []RepositoryEntry
+	for i := 0; i < 2; i++ {
+		select {
+		case repo := <-dispatched:
+			got = append(got, repo)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected release to be dispatched to 2 entries, got %d", len(got))
+		}
+	}
+	for _, repo := range got {
+		if repo.Discover != nil || repo.Mode == ModeTags {
+			t.Errorf("Unexpected dispatch to entry %+v", repo)
+		}
+	}
+
+	if code := sendTestWebhook(receiver, "s3cret", "release", "3", testReleaseWebhook); code != http.StatusOK {
+		t.Errorf("Expected redelivery to be acknowledged, got %d", code)
+	}
+	prerelease := strings.Replace(testReleaseWebhook, `"prerelease": false`, `"prerelease": true`, 1)
+	if code := sendTestWebhook(receiver, "s3cret", "release", "4", prerelease); code != http.StatusAccepted {
+		t.Errorf("Expected prerelease to be accepted, got %d", code)
+	}
+	select {
+	case repo := <-dispatched:
+		t.Errorf("Unexpected dispatch of a redelivery or prerelease to %+v", repo)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookReceiverSignatureAndRetries(t *testing.T) {
+	receiver := newWebhookReceiver("s3cret", []RepositoryEntry{{Owner: "rancher", Repo: "rancher"}}, nil)
+	receiver.dispatch = func(repo RepositoryEntry, release *Release) {}
+
+	mac := hmac.New(sha1.New, []byte("s3cret"))
+	mac.Write([]byte(testReleaseWebhook))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testReleaseWebhook))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "release")
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	receiver.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a delivery only signed with sha1 to be rejected, got %d", rec.Code)
+	}
+
+	if code := sendTestWebhook(receiver, "s3cret", "release", "1", `{"action": `); code != http.StatusBadRequest {
+		t.Fatalf("Expected the delivery to fail, got %d", code)
+	}
+	if code := sendTestWebhook(receiver, "s3cret", "release", "1", testReleaseWebhook); code != http.StatusAccepted {
+		t.Errorf("Expected the redelivery of a failed delivery to be processed, got %d", code)
+	}
+	if code := sendTestWebhook(receiver, "s3cret", "release", "1", testReleaseWebhook); code != http.StatusOK {
+		t.Errorf("Expected the redelivery of a processed delivery to be dropped, got %d", code)
+	}
+}
+
+func TestDeliverySet(t *testing.T) {
+	deliveries := newDeliverySet(2)
+	if !deliveries.add("a") || !deliveries.add("b") || deliveries.add("a") {
+		t.Errorf("Expected only the repeated delivery to be rejected")
+	}
+	deliveries.add("c")
+	if !deliveries.add("a") {
+		t.Errorf("Expected the oldest delivery to be forgotten")
+	}
+}
+
+func TestSharedReleaseHistory(t *testing.T) {
+	repo := RepositoryEntry{Owner: "webhook", Repo: "known"}
+	getReleaseHistory(repo).merge(map[string]bool{"v1.0.0": true})
+	history := getReleaseHistory(repo)
+	newReleases := history.checkForNewReleases(wrapReleases([]*github.RepositoryRelease{
+		{TagName: github.String("v1.0.0")},
+		{TagName: github.String("v1.1.0")},
+	}))
+	if len(newReleases) != 1 || newReleases[0].GetTagName() != "v1.1.0" {
+		t.Errorf("Expected only v1.1.0 to be new to the shared history")
+	}
+	if !history.releases["v1.1.0"] {
+		t.Errorf("Expected v1.1.0 to be recorded in the shared history")
+	}
+}